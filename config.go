@@ -0,0 +1,263 @@
+package shared
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/agile-work/srv-mdl-shared/tracing"
+	"gopkg.in/yaml.v2"
+)
+
+// configEnvPrefix prefix used by all the environment variables read by the config
+const configEnvPrefix = "MDL_"
+
+// Config defines all the settings needed to run a module
+//
+// Values are loaded with the following order of precedence, the first one found wins:
+//  1. command line flags (-dbHost)
+//  2. environment variables (MDL_DB_HOST)
+//  3. config file defined by -config or MDL_CONFIG (yaml or toml)
+//  4. defaults from NewConfig
+type Config struct {
+	Module   ModuleConfig   `yaml:"module" toml:"module"`
+	TLS      TLSConfig      `yaml:"tls" toml:"tls"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	Redis    RedisConfig    `yaml:"redis" toml:"redis"`
+	Socket   SocketConfig   `yaml:"socket" toml:"socket"`
+	Secrets  SecretsConfig  `yaml:"secrets" toml:"secrets"`
+	Tracing  tracing.Config `yaml:"tracing" toml:"tracing"`
+	LogLevel string         `yaml:"log_level" toml:"log_level" env:"LOG_LEVEL" flag:"logLevel" usage:"Log level (debug, info, warn or error)" validate:"oneof=debug info warn error"`
+	Store    bool           `yaml:"store" toml:"store" env:"STORE" flag:"store" usage:"Persist this instance to the database"`
+	Install  bool           `yaml:"install" toml:"install" env:"INSTALL" flag:"install" usage:"Install this module to the system"`
+}
+
+// ModuleConfig defines the module identification and address
+type ModuleConfig struct {
+	Code string `yaml:"code" toml:"code" validate:"required"`
+	Host string `yaml:"host" toml:"host" env:"HOST" flag:"host" usage:"Module host"`
+	Port int    `yaml:"port" toml:"port" env:"PORT" flag:"port" usage:"Module port" validate:"required,min=1"`
+}
+
+// TLSConfig defines the module listener mode and certificates
+//   - mtls: clients must present a certificate signed by the ClientCA bundle
+//   - tls: server certificate only
+//   - plaintext: no tls, for local development or behind a proxy or sidecar
+//
+// The key is read from the tls_key secret and falls back to the Key path,
+// the files are checked for changes on each ReloadInterval
+type TLSConfig struct {
+	Mode           string        `yaml:"mode" toml:"mode" env:"TLS_MODE" flag:"tlsMode" usage:"Listener mode (mtls, tls or plaintext)" validate:"oneof=mtls tls plaintext"`
+	Cert           string        `yaml:"cert" toml:"cert" env:"CERT" flag:"cert" usage:"Path to certification"`
+	Key            string        `yaml:"key" toml:"key" env:"KEY" flag:"key" usage:"Path to certification key"`
+	ClientCA       string        `yaml:"client_ca" toml:"client_ca" env:"CLIENT_CA" flag:"clientCA" usage:"Path to the CA bundle used to verify the clients in mtls mode"`
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval" env:"TLS_RELOAD_INTERVAL" flag:"tlsReloadInterval" usage:"Interval to check the certificate files for changes, 0 disables the reload"`
+	KeyPEM         []byte        `yaml:"-" toml:"-"`
+}
+
+// DatabaseConfig defines the database connection, the password is resolved by the SecretProvider
+type DatabaseConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST" flag:"dbHost" usage:"Database host" validate:"required"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT" flag:"dbPort" usage:"Database port" validate:"required,min=1"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER" flag:"dbUser" usage:"Database user" validate:"required"`
+	Password string `yaml:"-" toml:"-"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME" flag:"dbName" usage:"Database name" validate:"required"`
+}
+
+// RedisConfig defines the redis connection, the password is resolved by the SecretProvider
+type RedisConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"REDIS_HOST" flag:"redisHost" usage:"Redis host" validate:"required"`
+	Port     int    `yaml:"port" toml:"port" env:"REDIS_PORT" flag:"redisPort" usage:"Redis port" validate:"required,min=1"`
+	Password string `yaml:"-" toml:"-"`
+}
+
+// SocketConfig defines the realtime connection
+type SocketConfig struct {
+	Host string `yaml:"host" toml:"host" env:"WS_HOST" flag:"wsHost" usage:"Realtime host" validate:"required"`
+	Port int    `yaml:"port" toml:"port" env:"WS_PORT" flag:"wsPort" usage:"Realtime port" validate:"required,min=1"`
+}
+
+// SecretsConfig defines where the module secrets are read from
+//   - env: MDL_SECRET_DB_PASSWORD, MDL_SECRET_REDIS_PASSWORD and MDL_SECRET_TLS_KEY
+//   - file: one file per secret inside Dir (db_password, redis_password and tls_key)
+//   - exec: Command is executed with the secret name as the last argument
+type SecretsConfig struct {
+	Provider string `yaml:"provider" toml:"provider" env:"SECRETS_PROVIDER" flag:"secrets" usage:"Secrets provider (env, file or exec)" validate:"oneof=env file exec"`
+	Dir      string `yaml:"dir" toml:"dir" env:"SECRETS_DIR" flag:"secretsDir" usage:"Secrets directory for the file provider"`
+	Command  string `yaml:"command" toml:"command" env:"SECRETS_COMMAND" flag:"secretsCommand" usage:"Secrets helper command for the exec provider"`
+}
+
+// NewConfig returns a config with the defaults for a module
+func NewConfig(code, host string, port int) *Config {
+	return &Config{
+		Module:   ModuleConfig{Code: code, Host: host, Port: port},
+		TLS:      TLSConfig{Mode: TLSModeMutual, Cert: "cert.pem", Key: "key.pem", ClientCA: "ca.pem", ReloadInterval: 30 * time.Second},
+		Database: DatabaseConfig{Host: "localhost", Port: 5432, Name: "cryo"},
+		Redis:    RedisConfig{Host: "localhost", Port: 6379},
+		Socket:   SocketConfig{Host: "localhost", Port: 8010},
+		Secrets:  SecretsConfig{Provider: "env"},
+		Tracing:  tracing.Config{Exporter: "none", Endpoint: "localhost:4318"},
+		LogLevel: "info",
+	}
+}
+
+// Load reads the config file, the environment variables and the flags from args and validates the result
+func (c *Config) Load(args []string) error {
+	fs := flag.NewFlagSet(c.Module.Code, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(configEnvPrefix+"CONFIG"), "Path to the config file (yaml or toml)")
+
+	fields := configFields(reflect.ValueOf(c).Elem())
+	flags := map[string]*configFlag{}
+	for _, field := range fields {
+		if field.flag != "" {
+			f := &configFlag{kind: field.value.Kind()}
+			fs.Var(f, field.flag, field.usage)
+			flags[field.flag] = f
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range fields {
+		if field.env == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(configEnvPrefix + field.env); ok {
+			if err := setConfigValue(field.value, raw); err != nil {
+				return fmt.Errorf("config env %s%s: %s", configEnvPrefix, field.env, err.Error())
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if f, ok := flags[field.flag]; ok && f.set {
+			if err := setConfigValue(field.value, f.raw); err != nil {
+				return fmt.Errorf("config flag -%s: %s", field.flag, err.Error())
+			}
+		}
+	}
+
+	if err := Validate.Struct(c); err != nil {
+		return fmt.Errorf("invalid config: %s", err.Error())
+	}
+	if err := c.TLS.check(); err != nil {
+		return fmt.Errorf("invalid config: %s", err.Error())
+	}
+	return nil
+}
+
+// loadFile overrides the config with the values from a yaml or toml file
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %s", err.Error())
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	default:
+		return fmt.Errorf("config file: unsupported format %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file parse: %s", err.Error())
+	}
+	return nil
+}
+
+// configField links a config struct field to its env and flag names
+type configField struct {
+	value reflect.Value
+	env   string
+	flag  string
+	usage string
+}
+
+// configFields return all the config fields that can be set by env or flag
+func configFields(val reflect.Value) []configField {
+	fields := []configField{}
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			fields = append(fields, configFields(val.Field(i))...)
+			continue
+		}
+		fields = append(fields, configField{
+			value: val.Field(i),
+			env:   field.Tag.Get("env"),
+			flag:  field.Tag.Get("flag"),
+			usage: field.Tag.Get("usage"),
+		})
+	}
+	return fields
+}
+
+// setConfigValue parses the raw string to the field type
+func setConfigValue(val reflect.Value, raw string) error {
+	switch {
+	case val.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		val.SetInt(int64(d))
+	case val.Kind() == reflect.String:
+		val.SetString(raw)
+	case val.Kind() == reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		val.SetInt(int64(i))
+	case val.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		val.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", val.Type())
+	}
+	return nil
+}
+
+// configFlag keeps the raw flag value so it can be applied after the file and env values
+type configFlag struct {
+	kind reflect.Kind
+	raw  string
+	set  bool
+}
+
+func (f *configFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.raw
+}
+
+func (f *configFlag) Set(raw string) error {
+	f.raw = raw
+	f.set = true
+	return nil
+}
+
+// IsBoolFlag allows bool fields to be used as -flag without a value
+func (f *configFlag) IsBoolFlag() bool {
+	return f.kind == reflect.Bool
+}
@@ -0,0 +1,147 @@
+package shared
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes the content to a temporary config file with the extension
+func writeConfigFile(t *testing.T, ext, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "config"+ext)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setConfigEnv sets the environment variables restoring the previous values when the test ends
+func setConfigEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for name, val := range env {
+		previous, ok := os.LookupEnv(name)
+		os.Setenv(name, val)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func TestConfigLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     string
+		file    string
+		env     map[string]string
+		args    []string
+		check   func(c *Config) bool
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			check: func(c *Config) bool {
+				return c.Database.Host == "localhost" && c.Database.Port == 5432 && c.TLS.ReloadInterval == 30*time.Second
+			},
+			args: []string{"-dbUser", "cryo"},
+		},
+		{
+			name: "file over defaults",
+			ext:  ".yaml",
+			file: "database:\n  user: fileuser\n  host: filehost\nredis:\n  port: 1\n",
+			check: func(c *Config) bool {
+				return c.Database.User == "fileuser" && c.Database.Host == "filehost" && c.Database.Port == 5432
+			},
+		},
+		{
+			name:  "toml file",
+			ext:   ".toml",
+			file:  "[database]\nuser = \"tomluser\"\nport = 5433\n",
+			check: func(c *Config) bool { return c.Database.User == "tomluser" && c.Database.Port == 5433 },
+		},
+		{
+			name:  "env over file",
+			ext:   ".yaml",
+			file:  "database:\n  user: fileuser\n  host: filehost\n",
+			env:   map[string]string{"MDL_DB_HOST": "envhost"},
+			check: func(c *Config) bool { return c.Database.User == "fileuser" && c.Database.Host == "envhost" },
+		},
+		{
+			name:  "flags over env",
+			ext:   ".yaml",
+			file:  "database:\n  user: fileuser\nredis:\n  port: 1\n",
+			env:   map[string]string{"MDL_DB_HOST": "envhost", "MDL_REDIS_PORT": "2"},
+			args:  []string{"-dbHost", "flaghost", "-redisPort", "7000", "-store"},
+			check: func(c *Config) bool { return c.Database.Host == "flaghost" && c.Redis.Port == 7000 && c.Store },
+		},
+		{
+			name:  "file from env",
+			ext:   ".yaml",
+			file:  "database:\n  user: fileuser\n",
+			env:   map[string]string{"MDL_CONFIG": "{file}"},
+			check: func(c *Config) bool { return c.Database.User == "fileuser" },
+		},
+		{
+			name:  "yaml duration",
+			ext:   ".yaml",
+			file:  "database:\n  user: fileuser\ntls:\n  reload_interval: 5s\n",
+			check: func(c *Config) bool { return c.TLS.ReloadInterval == 5*time.Second },
+		},
+		{
+			name:  "env duration",
+			args:  []string{"-dbUser", "cryo"},
+			env:   map[string]string{"MDL_TLS_RELOAD_INTERVAL": "1m"},
+			check: func(c *Config) bool { return c.TLS.ReloadInterval == time.Minute },
+		},
+		{name: "missing required", wantErr: "invalid config"},
+		{name: "invalid env", args: []string{"-dbUser", "cryo"}, env: map[string]string{"MDL_DB_PORT": "port"}, wantErr: "config env MDL_DB_PORT"},
+		{name: "invalid flag", args: []string{"-dbUser", "cryo", "-dbPort", "port"}, wantErr: "config flag -dbPort"},
+		{name: "invalid mode", args: []string{"-dbUser", "cryo", "-tlsMode", "ssl"}, wantErr: "invalid config"},
+		{name: "mtls without ca", args: []string{"-dbUser", "cryo", "-clientCA", ""}, wantErr: "tls client_ca is required"},
+		{name: "unsupported file", ext: ".json", file: "{}", wantErr: "unsupported format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			path := ""
+			if tt.file != "" {
+				path = writeConfigFile(t, tt.ext, tt.file)
+				if _, ok := tt.env["MDL_CONFIG"]; !ok {
+					args = append([]string{"-config", path}, args...)
+				}
+			}
+			env := map[string]string{}
+			for name, val := range tt.env {
+				env[name] = strings.Replace(val, "{file}", path, 1)
+			}
+			setConfigEnv(t, env)
+
+			c := NewConfig("core", "", 8080)
+			err := c.Load(args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(c) {
+				t.Errorf("config = %+v", c)
+			}
+		})
+	}
+}
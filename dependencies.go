@@ -0,0 +1,135 @@
+package shared
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/agile-work/srv-shared/constants"
+	"github.com/agile-work/srv-shared/rdb"
+	"github.com/agile-work/srv-shared/service"
+	"github.com/agile-work/srv-shared/socket"
+	"github.com/agile-work/srv-shared/sql-builder/builder"
+	"github.com/agile-work/srv-shared/sql-builder/db"
+)
+
+// Database defines the database connection managed by the server
+type Database interface {
+	Connect(cfg DatabaseConfig) error
+	// Reconnect replaces the current connection by one opened with the config, the current
+	// connection must keep serving until the new one is open and is kept when it fails
+	Reconnect(cfg DatabaseConfig) error
+	Close()
+	Check(ctx context.Context) error
+}
+
+// DatabaseStats is implemented by the databases that report the connection pool,
+// the server exports the stats as metrics when the database implements it
+type DatabaseStats interface {
+	Stats() sql.DBStats
+}
+
+// Cache defines the redis connection managed by the server
+type Cache interface {
+	Connect(cfg RedisConfig) error
+	// Reconnect replaces the current connection by one opened with the config, the current
+	// connection must keep serving until the new one is open and is kept when it fails
+	Reconnect(cfg RedisConfig) error
+	Close()
+	Check(ctx context.Context) error
+}
+
+// Socket defines the realtime connection managed by the server
+type Socket interface {
+	Connect(module *service.Module, cfg SocketConfig) error
+	Close()
+	Available() bool
+	Emit(message socket.Message) error
+}
+
+// SocketNotifier is implemented by the sockets with connect and disconnect callbacks,
+// the server realtime client is then changed by the callbacks instead of checking Available
+type SocketNotifier interface {
+	OnConnectionChange(callback func(connected bool))
+}
+
+// sqlDatabase uses the sql-builder db package connection
+type sqlDatabase struct {
+	moduleCode string
+}
+
+func (d *sqlDatabase) Connect(cfg DatabaseConfig) error {
+	return db.Connect(cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, false)
+}
+
+// Reconnect connects again without closing the package connection first, db.Connect only
+// swaps it after the new one is open so the queries in flight are not interrupted
+func (d *sqlDatabase) Reconnect(cfg DatabaseConfig) error {
+	return d.Connect(cfg)
+}
+
+func (d *sqlDatabase) Close() {
+	db.Close()
+}
+
+// Check queries the module definition
+func (d *sqlDatabase) Check(ctx context.Context) error {
+	_, err := db.Count("id", constants.TableCoreModules, &db.Options{
+		Conditions: builder.Equal("code", d.moduleCode),
+	})
+	return err
+}
+
+// redisCache uses the rdb package connection and the redis package one for the atomic commands
+type redisCache struct {
+	healthKey string
+}
+
+func newRedisCache(moduleCode string) *redisCache {
+	return &redisCache{healthKey: fmt.Sprintf("module:health:%s:%d", moduleCode, os.Getpid())}
+}
+
+func (c *redisCache) Connect(cfg RedisConfig) error {
+	rdb.Init(cfg.Host, cfg.Port, cfg.Password)
+	redis.Init(cfg.Host, cfg.Port, cfg.Password)
+	return nil
+}
+
+// Reconnect initializes the package clients again without closing them first, rdb.Init
+// and redis.Init swap the client so the commands in flight finish on the previous one
+func (c *redisCache) Reconnect(cfg RedisConfig) error {
+	return c.Connect(cfg)
+}
+
+func (c *redisCache) Close() {
+	rdb.Close()
+	redis.Close()
+}
+
+// Check writes the instance health key
+func (c *redisCache) Check(ctx context.Context) error {
+	return rdb.Set(c.healthKey, time.Now().Format(time.RFC3339), time.Minute)
+}
+
+// serviceSocket uses the socket package connection
+type serviceSocket struct{}
+
+func (s *serviceSocket) Connect(module *service.Module, cfg SocketConfig) error {
+	socket.Init(module, cfg.Host, cfg.Port)
+	return nil
+}
+
+func (s *serviceSocket) Close() {
+	socket.Close()
+}
+
+func (s *serviceSocket) Available() bool {
+	return socket.Available()
+}
+
+func (s *serviceSocket) Emit(message socket.Message) error {
+	return socket.Emit(message)
+}
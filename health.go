@@ -0,0 +1,157 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/go-chi/render"
+)
+
+// HealthCheck verifies if a module dependency is working
+type HealthCheck func(ctx context.Context) error
+
+var (
+	healthChecksMutex  sync.Mutex
+	moduleHealthChecks = map[string]HealthCheck{}
+)
+
+// RegisterHealthCheck adds a module check to the readiness endpoint, it should be called before ListenAndServe
+func RegisterHealthCheck(name string, check HealthCheck) {
+	healthChecksMutex.Lock()
+	defer healthChecksMutex.Unlock()
+	moduleHealthChecks[name] = check
+}
+
+// HealthStatus defines the result of one check
+type HealthStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport defines the result of all the checks
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthStatus `json:"checks,omitempty"`
+}
+
+// Ready returns if all the checks are up
+func (r HealthReport) Ready() bool {
+	return r.Status == healthUp
+}
+
+const (
+	healthUp   = "up"
+	healthDown = "down"
+)
+
+// health runs the default and the module checks
+type health struct {
+	checks  map[string]HealthCheck
+	timeout time.Duration
+}
+
+// newHealth returns the default checks with the ones registered by the module
+func newHealth(defaults map[string]HealthCheck) *health {
+	h := &health{checks: map[string]HealthCheck{}, timeout: 5 * time.Second}
+	for name, check := range defaults {
+		h.checks[name] = check
+	}
+
+	healthChecksMutex.Lock()
+	defer healthChecksMutex.Unlock()
+	for name, check := range moduleHealthChecks {
+		h.checks[name] = check
+	}
+	return h
+}
+
+// check runs all the checks at the same time
+func (h *health) check(ctx context.Context) HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := HealthReport{Status: healthUp, Checks: map[string]HealthStatus{}}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			status := HealthStatus{Status: healthUp}
+			if err := runHealthCheck(ctx, check); err != nil {
+				status = HealthStatus{Status: healthDown, Error: err.Error()}
+			}
+			mutex.Lock()
+			report.Checks[name] = status
+			if status.Status == healthDown {
+				report.Status = healthDown
+			}
+			mutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return report
+}
+
+// watch runs the checks on each interval and calls onChange when the readiness changes,
+// if onChange fails it is called again on the next interval
+func (h *health) watch(ctx context.Context, interval time.Duration, ready bool, onChange func(ready bool) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report := h.check(ctx)
+			if report.Ready() != ready {
+				if err := onChange(report.Ready()); err != nil {
+					logger.Log.WithField("ready", report.Ready()).Errorf("readiness change: %s", err.Error())
+					continue
+				}
+				ready = report.Ready()
+			}
+		}
+	}
+}
+
+// liveHandler responds ok while the process is able to handle requests
+func (h *health) liveHandler(res http.ResponseWriter, req *http.Request) {
+	render.Status(req, http.StatusOK)
+	render.JSON(res, req, HealthReport{Status: healthUp})
+}
+
+// readyHandler responds with each check status and 503 if any of them is down
+func (h *health) readyHandler(res http.ResponseWriter, req *http.Request) {
+	report := h.check(req.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	render.Status(req, code)
+	render.JSON(res, req, report)
+}
+
+// runHealthCheck executes the check respecting the context deadline
+func runHealthCheck(ctx context.Context, check HealthCheck) error {
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
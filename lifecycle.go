@@ -0,0 +1,237 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultHookTimeout time limit for a hook without Timeout
+const DefaultHookTimeout = 10 * time.Second
+
+// Hook defines a named step executed when the module starts, stops or reloads
+// Hooks are started after the hooks in DependsOn and stopped before them
+type Hook struct {
+	Name      string
+	DependsOn []string
+	Timeout   time.Duration
+	OnStart   func(ctx context.Context) error
+	OnStop    func(ctx context.Context) error
+	OnReload  func(ctx context.Context) error
+}
+
+// HookError defines the error returned by a hook in a lifecycle phase
+type HookError struct {
+	Hook  string
+	Phase string
+	Err   error
+}
+
+// Error handling error struct to string
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s %s << %s", e.Hook, e.Phase, e.Err.Error())
+}
+
+// LifecycleError defines all the hooks that failed in a lifecycle phase
+type LifecycleError []*HookError
+
+// Error handling error struct to string
+func (e LifecycleError) Error() string {
+	msgs := []string{}
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Log writes each hook error with the hook fields
+func (e LifecycleError) Log() {
+	for _, err := range e {
+		logger.Log.WithFields(logrus.Fields{"hook": err.Hook, "phase": err.Phase}).Error(err.Err.Error())
+	}
+}
+
+// Lifecycle runs the module hooks ordered by their dependencies
+type Lifecycle struct {
+	hooks   []Hook
+	started []Hook
+}
+
+// NewLifecycle returns an empty lifecycle
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// Append adds hooks to the lifecycle, it should be called before Start
+func (l *Lifecycle) Append(hooks ...Hook) {
+	l.hooks = append(l.hooks, hooks...)
+}
+
+// Start executes the OnStart of each hook, if one of them fails the started hooks are stopped
+func (l *Lifecycle) Start(ctx context.Context) error {
+	hooks, err := l.order()
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		logger.Log.WithField("hook", hook.Name).Info("starting")
+		if err := runHook(ctx, hook, "start", hook.OnStart); err != nil {
+			errs := LifecycleError{err}
+			if stopErr := l.Stop(ctx); stopErr != nil {
+				errs = append(errs, stopErr.(LifecycleError)...)
+			}
+			return errs
+		}
+		l.started = append(l.started, hook)
+	}
+	return nil
+}
+
+// Stop executes the OnStop of the started hooks in the reverse order and returns every failure
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	errs := LifecycleError{}
+	for i := len(l.started) - 1; i >= 0; i-- {
+		hook := l.started[i]
+		logger.Log.WithField("hook", hook.Name).Info("stopping")
+		if err := runHook(ctx, hook, "stop", hook.OnStop); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	l.started = nil
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Reload executes the OnReload of the started hooks and returns every failure
+func (l *Lifecycle) Reload(ctx context.Context) error {
+	errs := LifecycleError{}
+	for _, hook := range l.started {
+		if err := runHook(ctx, hook, "reload", hook.OnReload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Run starts the lifecycle and blocks until SIGINT, SIGTERM or the context is done,
+// SIGHUP reloads the hooks without stopping the module
+func (l *Lifecycle) Run(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	if err := l.Start(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				logger.Log.Info("reloading service")
+				if err := l.Reload(ctx); err != nil {
+					err.(LifecycleError).Log()
+				}
+				continue
+			}
+			logger.Log.WithField("signal", sig.String()).Info("shutting down service")
+		case <-ctx.Done():
+			logger.Log.Info("shutting down service")
+		}
+		return l.Stop(context.Background())
+	}
+}
+
+// order sorts the hooks so each one comes after its dependencies keeping the append order
+func (l *Lifecycle) order() ([]Hook, error) {
+	names := map[string]bool{}
+	for _, hook := range l.hooks {
+		if names[hook.Name] {
+			return nil, fmt.Errorf("lifecycle hook %s defined twice", hook.Name)
+		}
+		names[hook.Name] = true
+	}
+	for _, hook := range l.hooks {
+		for _, dep := range hook.DependsOn {
+			if !names[dep] {
+				return nil, fmt.Errorf("lifecycle hook %s depends on undefined hook %s", hook.Name, dep)
+			}
+		}
+	}
+
+	ordered := []Hook{}
+	done := map[string]bool{}
+	for len(ordered) < len(l.hooks) {
+		added := false
+		for _, hook := range l.hooks {
+			if done[hook.Name] || !dependenciesDone(hook, done) {
+				continue
+			}
+			ordered = append(ordered, hook)
+			done[hook.Name] = true
+			added = true
+		}
+		if !added {
+			return nil, fmt.Errorf("lifecycle hooks with circular dependencies")
+		}
+	}
+	return ordered, nil
+}
+
+func dependenciesDone(hook Hook, done map[string]bool) bool {
+	for _, dep := range hook.DependsOn {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// runHook executes the hook function respecting the hook timeout
+func runHook(ctx context.Context, hook Hook, phase string, fn func(ctx context.Context) error) *HookError {
+	if fn == nil {
+		return nil
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return &HookError{Hook: hook.Name, Phase: phase, Err: err}
+		}
+		return nil
+	case <-ctx.Done():
+		return &HookError{Hook: hook.Name, Phase: phase, Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,177 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookRecorder records the hooks phases in the order they run
+type hookRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *hookRecorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *hookRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.calls, " ")
+}
+
+// hook returns a hook recording its start and stop, failing the phases in fail
+func (r *hookRecorder) hook(name string, fail string, deps ...string) Hook {
+	phase := func(prefix, phase string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			r.record(prefix + name)
+			if strings.Contains(fail, phase) {
+				return errors.New(name + " " + phase + " failed")
+			}
+			return nil
+		}
+	}
+	return Hook{Name: name, DependsOn: deps, OnStart: phase("+", "start"), OnStop: phase("-", "stop"), OnReload: phase("~", "reload")}
+}
+
+func TestLifecycleOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		hooks    func(r *hookRecorder) []Hook
+		startErr []string
+		stopErr  []string
+		want     string
+	}{
+		{
+			name: "append order",
+			hooks: func(r *hookRecorder) []Hook {
+				return []Hook{r.hook("a", ""), r.hook("b", ""), r.hook("c", "")}
+			},
+			want: "+a +b +c ~a ~b ~c -c -b -a",
+		},
+		{
+			name: "dependencies first",
+			hooks: func(r *hookRecorder) []Hook {
+				return []Hook{r.hook("jobs", "", "db"), r.hook("db", ""), r.hook("http", "", "jobs", "cache"), r.hook("cache", "")}
+			},
+			want: "+db +cache +jobs +http ~db ~cache ~jobs ~http -http -jobs -cache -db",
+		},
+		{
+			name: "stop errors are collected",
+			hooks: func(r *hookRecorder) []Hook {
+				return []Hook{r.hook("db", "stop"), r.hook("http", "stop", "db")}
+			},
+			stopErr: []string{"http", "db"},
+			want:    "+db +http ~db ~http -http -db",
+		},
+		{
+			name: "failed start stops the started hooks",
+			hooks: func(r *hookRecorder) []Hook {
+				return []Hook{r.hook("db", ""), r.hook("cache", "stop"), r.hook("http", "start", "db", "cache"), r.hook("register", "", "http")}
+			},
+			startErr: []string{"http", "cache"},
+			want:     "+db +cache +http -cache -db",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &hookRecorder{}
+			l := NewLifecycle()
+			l.Append(tt.hooks(r)...)
+
+			err := l.Start(context.Background())
+			assertHookErrors(t, "start", err, tt.startErr)
+			if err == nil {
+				if err := l.Reload(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+				assertHookErrors(t, "stop", l.Stop(context.Background()), tt.stopErr)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("calls = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func assertHookErrors(t *testing.T, phase string, err error, hooks []string) {
+	t.Helper()
+	if len(hooks) == 0 {
+		if err != nil {
+			t.Fatalf("%s error = %v", phase, err)
+		}
+		return
+	}
+	errs, ok := err.(LifecycleError)
+	if !ok || len(errs) != len(hooks) {
+		t.Fatalf("%s error = %v, want failures of %v", phase, err, hooks)
+	}
+	for i, hook := range hooks {
+		if errs[i].Hook != hook {
+			t.Errorf("%s error %d = %s, want %s", phase, i, errs[i].Hook, hook)
+		}
+	}
+}
+
+func TestLifecycleInvalid(t *testing.T) {
+	r := &hookRecorder{}
+	tests := []struct {
+		name  string
+		hooks []Hook
+		want  string
+	}{
+		{name: "circular dependencies", hooks: []Hook{r.hook("a", "", "b"), r.hook("b", "", "a")}, want: "circular"},
+		{name: "undefined dependency", hooks: []Hook{r.hook("a", "", "missing")}, want: "undefined hook missing"},
+		{name: "defined twice", hooks: []Hook{r.hook("a", ""), r.hook("a", "")}, want: "defined twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLifecycle()
+			l.Append(tt.hooks...)
+			if err := l.Start(context.Background()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("start error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if calls := r.String(); calls != "" {
+		t.Errorf("hooks started: %s", calls)
+	}
+}
+
+func TestLifecycleHookFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		hook Hook
+		want string
+	}{
+		{
+			name: "timeout",
+			hook: Hook{Name: "slow", Timeout: 10 * time.Millisecond, OnStart: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			}},
+			want: "slow start << context deadline exceeded",
+		},
+		{
+			name: "panic",
+			hook: Hook{Name: "broken", OnStart: func(ctx context.Context) error { panic("nil map") }},
+			want: "broken start << panic: nil map",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLifecycle()
+			l.Append(tt.hook)
+			if err := l.Start(context.Background()); err == nil || err.Error() != tt.want {
+				t.Errorf("start error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader header used to accept and forward the request id between modules
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength longest request id accepted from the header
+const maxRequestIDLength = 64
+
+type contextKey string
+
+const (
+	entryKey     contextKey = "logger"
+	requestIDKey contextKey = "request_id"
+)
+
+// Log global structured logger with JSON output
+var Log = newLogger()
+
+func newLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(os.Stdout)
+	log.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	return log
+}
+
+// SetLevel defines the minimum level logged (debug, info, warn, error)
+func SetLevel(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Log.SetLevel(lvl)
+	return nil
+}
+
+// Middleware accepts the request id from the header or generates a new one when it is missing or
+// invalid and injects a logger with the request fields in the context, logging each request when it ends
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(RequestIDHeader)
+		if !ValidRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+		res.Header().Set(RequestIDHeader, requestID)
+
+		entry := Log.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"method":     req.Method,
+			"path":       req.URL.Path,
+		})
+		ctx := WithRequestID(req.Context(), requestID)
+		ctx = context.WithValue(ctx, entryKey, entry)
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+		next.ServeHTTP(ww, req.WithContext(ctx))
+
+		fields := logrus.Fields{
+			"status":      ww.Status(),
+			"bytes":       ww.BytesWritten(),
+			"duration_ms": float64(time.Since(start).Nanoseconds()) / 1e6,
+			"remote_addr": req.RemoteAddr,
+		}
+		if rctx := chi.RouteContext(ctx); rctx != nil {
+			fields["route"] = rctx.RoutePattern()
+		}
+		entry.WithFields(fields).Info("request")
+	})
+}
+
+// FromContext returns the request logger or the global one when the context has none
+func FromContext(ctx context.Context) *logrus.Entry {
+	if ctx != nil {
+		if entry, ok := ctx.Value(entryKey).(*logrus.Entry); ok {
+			return entry
+		}
+		if requestID := RequestID(ctx); requestID != "" {
+			return Log.WithField("request_id", requestID)
+		}
+	}
+	return logrus.NewEntry(Log)
+}
+
+// WithRequestID returns a context carrying the request id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request id from the context
+func RequestID(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDKey).(string); ok {
+		return requestID
+	}
+	return ""
+}
+
+// ValidRequestID returns if the request id has up to 64 letters, digits, dots, dashes or underscores
+func ValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// NewRequestID generates a random request id
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Client http client for the calls between modules and the job tasks exec address,
+// it forwards the request id of the request context
+var Client = &http.Client{Transport: &Transport{}}
+
+// Transport forwards the request id from the request context on outbound calls
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip sets the request id header and executes the request with the base transport
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if requestID := RequestID(req.Context()); requestID != "" && req.Header.Get(RequestIDHeader) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	return base.RoundTrip(req)
+}
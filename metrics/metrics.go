@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "module"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total of http requests by route pattern and status code",
+	}, []string{"method", "route", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Http request latencies by route pattern",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Http requests being served",
+	})
+	redisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Redis command latencies",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"command", "status"})
+	jobInstances = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_instances_created_total",
+		Help:      "Job instances created by job code",
+	}, []string{"job_code", "status"})
+	jobTaskInstances = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_task_instances_created_total",
+		Help:      "Job task instances created",
+	}, []string{"status"})
+	rateLimitFailOpen = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_fail_open_total",
+		Help:      "Requests allowed without the rate limit because redis failed, by route pattern",
+	}, []string{"route"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpDuration, httpInFlight, redisDuration, jobInstances, jobTaskInstances, rateLimitFailOpen)
+}
+
+// Handler returns the http handler exposing the metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware measures the requests by the chi route pattern
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(res, req.ProtoMajor)
+		next.ServeHTTP(ww, req)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequests.WithLabelValues(req.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(req.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveRedis records the latency of a redis command started at start
+func ObserveRedis(command string, start time.Time, err error) {
+	redisDuration.WithLabelValues(command, status(err)).Observe(time.Since(start).Seconds())
+}
+
+// JobInstanceCreated counts a job instance creation
+func JobInstanceCreated(jobCode string, err error) {
+	jobInstances.WithLabelValues(jobCode, status(err)).Inc()
+}
+
+// JobTaskInstanceCreated counts a job task instance creation
+func JobTaskInstanceCreated(err error) {
+	jobTaskInstances.WithLabelValues(status(err)).Inc()
+}
+
+// RateLimitFailOpen counts a request allowed because its rate limit could not be checked
+func RateLimitFailOpen(route string) {
+	rateLimitFailOpen.WithLabelValues(route).Inc()
+}
+
+// RegisterDBStats exposes the database connection pool stats
+func RegisterDBStats(stats func() sql.DBStats) error {
+	return prometheus.Register(&dbStatsCollector{stats: stats})
+}
+
+func status(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// dbStatsCollector collects the sql.DBStats on each scrape
+type dbStatsCollector struct {
+	stats func() sql.DBStats
+}
+
+var (
+	dbMaxOpen      = prometheus.NewDesc(namespace+"_db_max_open_connections", "Maximum number of open connections to the database", nil, nil)
+	dbOpen         = prometheus.NewDesc(namespace+"_db_open_connections", "Established connections both in use and idle", nil, nil)
+	dbInUse        = prometheus.NewDesc(namespace+"_db_in_use_connections", "Connections currently in use", nil, nil)
+	dbIdle         = prometheus.NewDesc(namespace+"_db_idle_connections", "Idle connections", nil, nil)
+	dbWaitCount    = prometheus.NewDesc(namespace+"_db_wait_count_total", "Connections waited for", nil, nil)
+	dbWaitDuration = prometheus.NewDesc(namespace+"_db_wait_duration_seconds_total", "Time blocked waiting for a new connection", nil, nil)
+)
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpen
+	ch <- dbOpen
+	ch <- dbInUse
+	ch <- dbIdle
+	ch <- dbWaitCount
+	ch <- dbWaitDuration
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
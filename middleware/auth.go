@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/response"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ValidateToken validates a token issued by user.Login and returns its payload, the module
+// defines it with the validator of the token issuer before mounting Authenticate
+var ValidateToken func(tokenString string) (map[string]interface{}, error)
+
+// Authenticate validates the bearer token with ValidateToken, loads the user
+// and stores the principal in the request context
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		principal, err := authenticate(req)
+		if err != nil {
+			resp := response.New()
+			resp.NewError("authenticate", err)
+			resp.Render(res, req)
+			return
+		}
+
+		trace.SpanFromContext(req.Context()).SetAttributes(attribute.String("enduser.id", principal.Username))
+		next.ServeHTTP(res, req.WithContext(user.NewContext(req.Context(), principal)))
+	})
+}
+
+// authenticate returns the principal of the request token
+func authenticate(req *http.Request) (*user.Principal, error) {
+	tokenString, err := bearerToken(req)
+	if err != nil {
+		return nil, customerror.New(http.StatusUnauthorized, "token", err.Error())
+	}
+
+	if ValidateToken == nil {
+		return nil, customerror.New(http.StatusInternalServerError, "token", "token validator not defined")
+	}
+	payload, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, customerror.New(http.StatusUnauthorized, "token", err.Error())
+	}
+
+	username, _ := payload["code"].(string)
+	if username == "" {
+		return nil, customerror.NewKey(http.StatusUnauthorized, "token", "auth.invalid_token", nil)
+	}
+
+	u := &user.User{Username: username}
+	if err := u.Load(req.Context()); err != nil {
+		return nil, err
+	}
+	if u.ID == "" {
+		return nil, customerror.NewKey(http.StatusUnauthorized, "user", "user.not_found", nil)
+	}
+	if !u.Active {
+		return nil, customerror.NewKey(http.StatusUnauthorized, "user", "user.deactivated", nil)
+	}
+	u.Password = ""
+
+	languageCode, _ := payload["language_code"].(string)
+	return user.NewPrincipal(u, languageCode), nil
+}
+
+// bearerToken returns the token from the Authorization header
+func bearerToken(req *http.Request) (string, error) {
+	header := req.Header.Get("Authorization")
+	if header == "" {
+		return "", errors.New("authorization header not found")
+	}
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", errors.New("invalid authorization header")
+	}
+	return strings.TrimSpace(parts[1]), nil
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		validate func(string) (map[string]interface{}, error)
+		want     int
+	}{
+		{name: "validator not defined", header: "Bearer abc", want: http.StatusInternalServerError},
+		{name: "without header", validate: func(string) (map[string]interface{}, error) { return nil, nil }, want: http.StatusUnauthorized},
+		{name: "not bearer", header: "Basic abc", validate: func(string) (map[string]interface{}, error) { return nil, nil }, want: http.StatusUnauthorized},
+		{name: "invalid token", header: "Bearer abc", validate: func(string) (map[string]interface{}, error) { return nil, errors.New("expired") }, want: http.StatusUnauthorized},
+		{name: "without username", header: "Bearer abc", validate: func(string) (map[string]interface{}, error) { return map[string]interface{}{}, nil }, want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := ValidateToken
+			ValidateToken = tt.validate
+			defer func() { ValidateToken = previous }()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			_, err := authenticate(req)
+			if got := customerror.Status(err); got != tt.want {
+				t.Errorf("status = %d %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
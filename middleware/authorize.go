@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/feature"
+	"github.com/agile-work/srv-mdl-shared/models/module"
+	"github.com/agile-work/srv-mdl-shared/models/response"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/go-chi/chi"
+)
+
+// Authorizer checks the principal security grants against the features of the loaded module definition
+type Authorizer struct {
+	definition module.Definition
+}
+
+// NewAuthorizer returns an authorizer for the module definition features
+func NewAuthorizer(definition module.Definition) *Authorizer {
+	return &Authorizer{definition: definition}
+}
+
+// RequirePermission returns a middleware that responds 403 when the principal was not granted the
+// feature permission, it should be used after Authenticate and returns an error if the permission
+// is not defined in the module definition features
+func (a *Authorizer) RequirePermission(featureCode, permissionCode string) (func(http.Handler) http.Handler, error) {
+	f, ok := a.definition.Features[featureCode]
+	if !ok {
+		return nil, fmt.Errorf("authorizer: feature %s not defined", featureCode)
+	}
+	permission, ok := f.Permission(permissionCode)
+	if !ok {
+		return nil, fmt.Errorf("authorizer: permission %s not defined in feature %s", permissionCode, featureCode)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return &permissionHandler{
+			featureCode:    featureCode,
+			permissionCode: permissionCode,
+			feature:        f,
+			permission:     permission,
+			next:           next,
+		}
+	}, nil
+}
+
+// permissionHandler keeps the required permission so it can be listed by Permissions
+type permissionHandler struct {
+	featureCode    string
+	permissionCode string
+	feature        feature.Feature
+	permission     translation.Translation
+	next           http.Handler
+}
+
+func (h *permissionHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	principal, ok := user.FromContext(req.Context())
+	if !ok {
+		resp := response.New()
+		resp.NewError("authorize", customerror.NewKey(http.StatusUnauthorized, "principal", "auth.not_authenticated", nil))
+		resp.Render(res, req)
+		return
+	}
+
+	if !principal.User.HasPermission(h.featureCode, h.permissionCode) {
+		resp := response.New()
+		resp.NewError("authorize", customerror.NewKey(http.StatusForbidden, "permission", "auth.permission_denied", map[string]interface{}{
+			"feature":    h.feature.Name,
+			"permission": h.permission,
+		}))
+		resp.Render(res, req)
+		return
+	}
+
+	h.next.ServeHTTP(res, req)
+}
+
+// RoutePermission defines the permission required by a route
+type RoutePermission struct {
+	Method     string `json:"method"`
+	Route      string `json:"route"`
+	Feature    string `json:"feature"`
+	Permission string `json:"permission"`
+}
+
+// Permissions lists the permission required by each route, routes without RequirePermission are not listed
+func Permissions(routes chi.Routes) ([]RoutePermission, error) {
+	sentinel := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	permissions := []RoutePermission{}
+
+	err := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.Replace(route, "/*/", "/", -1)
+		add := func(h http.Handler) {
+			if ph, ok := h.(*permissionHandler); ok {
+				permissions = append(permissions, RoutePermission{
+					Method:     method,
+					Route:      route,
+					Feature:    ph.featureCode,
+					Permission: ph.permissionCode,
+				})
+			}
+		}
+		for _, mw := range middlewares {
+			add(mw(sentinel))
+		}
+		add(handler)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(permissions, func(i, j int) bool {
+		if permissions[i].Route == permissions[j].Route {
+			return permissions[i].Method < permissions[j].Method
+		}
+		return permissions[i].Route < permissions[j].Route
+	})
+	return permissions, nil
+}
+
+// PermissionsHandler responds with the permission required by each route
+func PermissionsHandler(routes chi.Routes) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		resp := response.New()
+		permissions, err := Permissions(routes)
+		if err != nil {
+			resp.NewError("permissions", err)
+		}
+		resp.Data = permissions
+		resp.Render(res, req)
+	}
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/module"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/go-chi/chi"
+)
+
+func testDefinition(t *testing.T) module.Definition {
+	definition := module.Definition{}
+	err := json.Unmarshal([]byte(`{"features":{"contracts":{"name":{"en":"Contracts"},"description":{"en":"d"},"permissions":{"view":{"en":"View"},"edit":{"en":"Edit"},"delete":{"en":"Delete"},"approve":{"en":"Approve"}}}}}`), &definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return definition
+}
+
+func TestRequirePermissionNotDefined(t *testing.T) {
+	a := NewAuthorizer(testDefinition(t))
+	tests := []struct {
+		feature    string
+		permission string
+		fails      bool
+	}{
+		{"contracts", "edit", false},
+		{"contracts", "archive", true},
+		{"orders", "view", true},
+	}
+	for _, tt := range tests {
+		if _, err := a.RequirePermission(tt.feature, tt.permission); (err != nil) != tt.fails {
+			t.Errorf("%s %s: got error %v", tt.feature, tt.permission, err)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	a := NewAuthorizer(testDefinition(t))
+	security := func(raw string) *user.User {
+		u := &user.User{Username: "x"}
+		if raw != "" {
+			if err := json.Unmarshal([]byte(`{"security":`+raw+`}`), u); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return u
+	}
+	tests := []struct {
+		name       string
+		user       *user.User
+		permission string
+		status     int
+	}{
+		{"no principal", nil, "edit", http.StatusUnauthorized},
+		{"no security", security(""), "edit", http.StatusForbidden},
+		{"other feature", security(`{"features":{"orders":{"edit":true}}}`), "edit", http.StatusForbidden},
+		{"view only edit", security(`{"features":{"contracts":{"view":true}}}`), "edit", http.StatusForbidden},
+		{"view only view", security(`{"features":{"contracts":{"view":true}}}`), "view", http.StatusOK},
+		{"edit", security(`{"features":{"contracts":{"edit":true}}}`), "edit", http.StatusOK},
+		{"edit false", security(`{"features":{"contracts":{"edit":false}}}`), "edit", http.StatusForbidden},
+		{"editable fields edit", security(`{"schema":{"contracts":{"edit":{"total":true}}}}`), "edit", http.StatusForbidden},
+		{"editable fields delete", security(`{"schema":{"contracts":{"edit":{"total":true}}},"features":{"contracts":{"edit":true}}}`), "delete", http.StatusForbidden},
+		{"editable fields approve", security(`{"schema":{"contracts":{"trees":[{"tree":"t","edit":{"total":true}}]}},"features":{"contracts":{"view":true}}}`), "approve", http.StatusForbidden},
+		{"delete granted", security(`{"features":{"contracts":{"delete":true}}}`), "delete", http.StatusOK},
+	}
+	for _, tt := range tests {
+		mw, err := a.RequirePermission("contracts", tt.permission)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := mw(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if tt.user != nil {
+			req = req.WithContext(user.NewContext(req.Context(), user.NewPrincipal(tt.user, "en")))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d %s", tt.name, w.Code, tt.status, w.Body.String())
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	a := NewAuthorizer(testDefinition(t))
+	mw, err := a.RequirePermission("contracts", "edit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := chi.NewRouter()
+	sub.With(mw).Post("/contracts", func(http.ResponseWriter, *http.Request) {})
+	sub.Get("/open", func(http.ResponseWriter, *http.Request) {})
+	r := chi.NewRouter()
+	r.Mount("/api/v1", sub)
+
+	permissions, err := Permissions(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 1 || permissions[0].Route != "/api/v1/contracts" || permissions[0].Method != http.MethodPost || permissions[0].Feature != "contracts" {
+		t.Fatal(permissions)
+	}
+}
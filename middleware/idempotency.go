@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/metrics"
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/response"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/agile-work/srv-shared/rdb"
+)
+
+// Idempotency headers and redis key prefix
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+	IdempotencyKeyPrefix      = "idempotency:"
+)
+
+// Idempotency stores the first response of a POST with an Idempotency-Key header and replays it
+// for the repeated requests of the same user and path, while the first one is running the repeated
+// requests are rejected with 409
+type Idempotency struct {
+	// TTL time the response is kept for replays
+	TTL time.Duration
+	// LockTimeout time a running request holds the key, after it the request can be executed again
+	LockTimeout time.Duration
+}
+
+// NewIdempotency returns the middleware keeping the responses for ttl
+func NewIdempotency(ttl time.Duration) *Idempotency {
+	return &Idempotency{TTL: ttl, LockTimeout: time.Minute}
+}
+
+// idempotentResponse defines the stored request state and response
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Handler honours the Idempotency-Key header, it should be used after Authenticate so the keys are
+// stored by username, module requests are stored by the certificate common name and the keys of
+// other requests are rejected, responses that depend on the moment like server errors, 409 and 429
+// are not stored and the request can be retried
+func (i *Idempotency) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		idempotencyKey := req.Header.Get(IdempotencyKeyHeader)
+		if req.Method != http.MethodPost || idempotencyKey == "" {
+			next.ServeHTTP(res, req)
+			return
+		}
+		log := logger.FromContext(req.Context()).WithField("idempotency_key", idempotencyKey)
+
+		owner := idempotencyOwner(req)
+		if owner == "" {
+			renderError(res, req, customerror.NewKey(http.StatusUnauthorized, "idempotency", "idempotency.anonymous", nil))
+			return
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			renderError(res, req, customerror.New(http.StatusBadRequest, "idempotency", err.Error()))
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		key := IdempotencyKeyPrefix + owner + ":" + req.URL.Path + ":" + idempotencyKey
+
+		running, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+		start := time.Now()
+		locked, err := redis.SetNX(key, string(running), i.LockTimeout)
+		metrics.ObserveRedis("setnx", start, err)
+		if err != nil {
+			log.Warnf("idempotency lock: %s", err.Error())
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if !locked {
+			i.replay(res, req, key, fingerprint)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: res, status: http.StatusOK, body: &bytes.Buffer{}}
+		next.ServeHTTP(rec, req)
+
+		if !storedStatus(rec.status) {
+			if err := rdb.Delete(key); err != nil {
+				log.Warnf("idempotency release: %s", err.Error())
+			}
+			return
+		}
+
+		stored, _ := json.Marshal(idempotentResponse{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      rec.status,
+			Header:      replayHeader(rec.Header()),
+			Body:        rec.body.Bytes(),
+		})
+		start = time.Now()
+		err = rdb.Set(key, string(stored), i.TTL)
+		metrics.ObserveRedis("set", start, err)
+		if err != nil {
+			log.Warnf("idempotency store: %s", err.Error())
+		}
+	})
+}
+
+// idempotencyOwner returns who the keys belong to, the principal username or the
+// calling module certificate, and empty when the request is anonymous
+func idempotencyOwner(req *http.Request) string {
+	if principal, ok := user.FromContext(req.Context()); ok {
+		return "user:" + principal.Username
+	}
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		return "module:" + req.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return ""
+}
+
+// storedStatus returns if a response is replayed, the ones that can change when the
+// request is retried, timeouts, conflicts, rate limits and server errors, are not stored
+func storedStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+// replay writes the stored response or rejects the request while the first one is running
+func (i *Idempotency) replay(res http.ResponseWriter, req *http.Request, key, fingerprint string) {
+	start := time.Now()
+	raw, err := rdb.Get(key)
+	metrics.ObserveRedis("get", start, err)
+	if err != nil || raw == "" {
+		renderError(res, req, customerror.NewKey(http.StatusConflict, "idempotency", "idempotency.running", nil))
+		return
+	}
+
+	stored := idempotentResponse{}
+	if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+		renderError(res, req, customerror.New(http.StatusInternalServerError, "idempotency", err.Error()))
+		return
+	}
+
+	if stored.Fingerprint != fingerprint {
+		renderError(res, req, customerror.NewKey(http.StatusUnprocessableEntity, "idempotency", "idempotency.key_reused", nil))
+		return
+	}
+	if !stored.Completed {
+		renderError(res, req, customerror.NewKey(http.StatusConflict, "idempotency", "idempotency.running", nil))
+		return
+	}
+
+	for name, values := range stored.Header {
+		for _, value := range values {
+			res.Header().Add(name, value)
+		}
+	}
+	res.Header().Set(IdempotencyReplayedHeader, "true")
+	res.WriteHeader(stored.Status)
+	res.Write(stored.Body)
+}
+
+// replayHeader returns the response headers that are stored for the replays,
+// headers set by the server for each response like the request id are not stored
+func replayHeader(header http.Header) http.Header {
+	stored := http.Header{}
+	for _, name := range []string{"Content-Type", "Location"} {
+		if values, ok := header[name]; ok {
+			stored[name] = values
+		}
+	}
+	return stored
+}
+
+// renderError responds with the error in the default response
+func renderError(res http.ResponseWriter, req *http.Request, err error) {
+	resp := response.New()
+	resp.NewError("idempotency", err)
+	resp.Render(res, req)
+}
+
+// responseRecorder writes the response keeping a copy of the status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   *bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush flushes the wrapped writer so the exports are still streamed when the request is idempotent
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
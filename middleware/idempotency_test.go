@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/user"
+)
+
+func TestStoredStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{status: http.StatusOK, want: true},
+		{status: http.StatusCreated, want: true},
+		{status: http.StatusBadRequest, want: true},
+		{status: http.StatusUnprocessableEntity, want: true},
+		{status: http.StatusRequestTimeout},
+		{status: http.StatusConflict},
+		{status: http.StatusTooManyRequests},
+		{status: http.StatusInternalServerError},
+		{status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			if got := storedStatus(tt.status); got != tt.want {
+				t.Errorf("storedStatus(%d) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyOwner(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal string
+		module    string
+		want      string
+	}{
+		{name: "user", principal: "bob", want: "user:bob"},
+		{name: "user from a module", principal: "bob", module: "core", want: "user:bob"},
+		{name: "module", module: "core", want: "module:core"},
+		{name: "anonymous"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/jobs", nil)
+			if tt.principal != "" {
+				req = req.WithContext(user.NewContext(req.Context(), user.NewPrincipal(&user.User{Username: tt.principal}, "en")))
+			}
+			if tt.module != "" {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: tt.module}}}}
+			}
+			if got := idempotencyOwner(req); got != tt.want {
+				t.Errorf("owner = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyAnonymous(t *testing.T) {
+	called := false
+	h := NewIdempotency(0).Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("{}"))
+	req.Header.Set(IdempotencyKeyHeader, "abc")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if called || rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d called = %v, want 401 without calling the handler", rec.Code, called)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("{}"))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !called {
+		t.Error("request without key not handled")
+	}
+}
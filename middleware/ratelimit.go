@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/metrics"
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/response"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/go-chi/chi"
+)
+
+// RateLimitKeyPrefix prefix of the redis keys used to count the requests
+const RateLimitKeyPrefix = "ratelimit:"
+
+// RateLimit defines the number of requests allowed in a window, a zero limit disables it
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// RateLimiter limits the requests to each route pattern by username and by calling module
+// instance, unauthenticated requests without a client certificate are limited by address
+//
+// Requests are counted in redis with a sliding window, the counts of the current and the previous
+// windows are weighted by the time elapsed in the current one
+type RateLimiter struct {
+	// Default limit for the routes not defined in Routes
+	Default RateLimit
+	// Routes limits by the route pattern of the router, /jobs/{code}
+	Routes map[string]RateLimit
+	// Users and Modules replace the route limits for a username or a module certificate common name
+	Users   map[string]RateLimit
+	Modules map[string]RateLimit
+
+	routes chi.Routes
+}
+
+// NewRateLimiter returns a limiter for the routes of the router it is used in
+func NewRateLimiter(routes chi.Routes, defaultLimit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		Default: defaultLimit,
+		Routes:  map[string]RateLimit{},
+		Users:   map[string]RateLimit{},
+		Modules: map[string]RateLimit{},
+		routes:  routes,
+	}
+}
+
+// Limit responds 429 with Retry-After when the request exceeds any of its limits,
+// it should be used after Authenticate so the requests are counted by username
+// only allowed requests are counted and if redis is not available the request is allowed
+func (l *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		pattern := l.routePattern(req)
+		windows := []rateLimitWindow{}
+		for _, subject := range l.subjects(req, pattern) {
+			if subject.limit.Requests > 0 && subject.limit.Window > 0 {
+				windows = append(windows, newRateLimitWindow(RateLimitKeyPrefix+pattern, subject, time.Now()))
+			}
+		}
+
+		denied, retryAfter, err := countRequest(windows)
+		if err != nil {
+			logger.FromContext(req.Context()).WithField("route", pattern).Warnf("rate limit not checked: %s", err.Error())
+			metrics.RateLimitFailOpen(pattern)
+		}
+		if denied != "" {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			res.Header().Set("Retry-After", strconv.Itoa(seconds))
+			resp := response.New()
+			resp.NewError("rate limit", customerror.NewKey(http.StatusTooManyRequests, denied, "request.too_many", map[string]interface{}{"seconds": seconds}))
+			resp.Render(res, req)
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// rateLimitSubject defines who is counted and its limit
+type rateLimitSubject struct {
+	key   string
+	limit RateLimit
+}
+
+// subjects returns the username and the module of the request with their limits
+func (l *RateLimiter) subjects(req *http.Request, pattern string) []rateLimitSubject {
+	limit, ok := l.Routes[pattern]
+	if !ok {
+		limit = l.Default
+	}
+
+	subjects := []rateLimitSubject{}
+	if principal, ok := user.FromContext(req.Context()); ok {
+		userLimit, ok := l.Users[principal.Username]
+		if !ok {
+			userLimit = limit
+		}
+		subjects = append(subjects, rateLimitSubject{key: "user:" + principal.Username, limit: userLimit})
+	}
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		module := req.TLS.PeerCertificates[0].Subject.CommonName
+		moduleLimit, ok := l.Modules[module]
+		if !ok {
+			moduleLimit = limit
+		}
+		subjects = append(subjects, rateLimitSubject{key: "module:" + module, limit: moduleLimit})
+	}
+	if len(subjects) == 0 {
+		host, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			host = req.RemoteAddr
+		}
+		subjects = append(subjects, rateLimitSubject{key: "addr:" + host, limit: limit})
+	}
+	return subjects
+}
+
+// routePattern returns the pattern that matches the request in the limiter router
+func (l *RateLimiter) routePattern(req *http.Request) string {
+	path := req.URL.Path
+	if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePath != "" {
+		path = rctx.RoutePath
+	}
+	if l.routes != nil {
+		rctx := chi.NewRouteContext()
+		if l.routes.Match(rctx, req.Method, path) {
+			return rctx.RoutePattern()
+		}
+	}
+	return "*"
+}
+
+// rateLimitScript reads the current and previous window counts of every subject, KEYS[2n-1] and
+// KEYS[2n], and counts the request in the current windows only when every subject allows it,
+// ARGV[3n-2] is the subject limit, ARGV[3n-1] the previous window weight and ARGV[3n] the
+// current window ttl in milliseconds, returns 1 when allowed followed by the counts read
+const rateLimitScript = `
+local allowed = 1
+local counts = {}
+for n = 1, #KEYS / 2 do
+	local current = tonumber(redis.call('GET', KEYS[2 * n - 1]) or '0')
+	local previous = tonumber(redis.call('GET', KEYS[2 * n]) or '0')
+	if previous * tonumber(ARGV[3 * n - 1]) + current + 1 > tonumber(ARGV[3 * n - 2]) then
+		allowed = 0
+	end
+	counts[#counts + 1] = previous
+	counts[#counts + 1] = current
+end
+if allowed == 1 then
+	for n = 1, #KEYS / 2 do
+		redis.call('INCR', KEYS[2 * n - 1])
+		redis.call('PEXPIRE', KEYS[2 * n - 1], ARGV[3 * n])
+	end
+end
+return {allowed, unpack(counts)}
+`
+
+// rateLimitWindow defines the keys of a subject counts in the current and previous windows
+type rateLimitWindow struct {
+	subject     rateLimitSubject
+	currentKey  string
+	previousKey string
+	elapsed     time.Duration
+}
+
+// newRateLimitWindow returns the subject window of now
+func newRateLimitWindow(prefix string, subject rateLimitSubject, now time.Time) rateLimitWindow {
+	window := now.Truncate(subject.limit.Window)
+	key := prefix + ":" + subject.key
+	return rateLimitWindow{
+		subject:     subject,
+		currentKey:  fmt.Sprintf("%s:%d", key, window.UnixNano()),
+		previousKey: fmt.Sprintf("%s:%d", key, window.Add(-subject.limit.Window).UnixNano()),
+		elapsed:     now.Sub(window),
+	}
+}
+
+// countRequest checks and counts the request in one script so concurrent requests do not read the same
+// counts, returns the first subject that does not allow the request and the longest time until
+// every subject allows it
+func countRequest(windows []rateLimitWindow) (string, time.Duration, error) {
+	if len(windows) == 0 {
+		return "", 0, nil
+	}
+
+	keys := []string{}
+	args := []interface{}{}
+	for _, w := range windows {
+		limit := w.subject.limit
+		keys = append(keys, w.currentKey, w.previousKey)
+		// the current count is the previous one in the next window so it expires after it
+		args = append(args, limit.Requests, strconv.FormatFloat(weight(limit, w.elapsed), 'f', -1, 64), 2*limit.Window)
+	}
+
+	start := time.Now()
+	reply, err := redis.Eval(rateLimitScript, keys, args...)
+	metrics.ObserveRedis("eval", start, err)
+	if err != nil {
+		return "", 0, err
+	}
+	counts, ok := reply.([]interface{})
+	if !ok || len(counts) != 1+2*len(windows) {
+		return "", 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	if allowed, _ := counts[0].(int64); allowed == 1 {
+		return "", 0, nil
+	}
+
+	denied, retryAfter := "", time.Duration(0)
+	for i, w := range windows {
+		previous, _ := counts[1+2*i].(int64)
+		current, _ := counts[2+2*i].(int64)
+		if allowed, wait := decide(int(previous), int(current), w.subject.limit, w.elapsed); !allowed {
+			if denied == "" {
+				denied = w.subject.key
+			}
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	return denied, retryAfter, nil
+}
+
+// weight returns the weight of the previous window count, the time left in the current window
+func weight(limit RateLimit, elapsed time.Duration) float64 {
+	return float64(limit.Window-elapsed) / float64(limit.Window)
+}
+
+// decide returns if a new request fits in the limit with the previous window count weighted by
+// the time left in the current window, when it does not returns the time until it fits
+func decide(previous, current int, limit RateLimit, elapsed time.Duration) (bool, time.Duration) {
+	if float64(previous)*weight(limit, elapsed)+float64(current+1) <= float64(limit.Requests) {
+		return true, 0
+	}
+
+	retryAfter := limit.Window - elapsed
+	if room := float64(limit.Requests) - float64(current+1); room >= 0 && previous > 0 {
+		// the previous window weight decreases over time until it leaves room for the request
+		retryAfter = time.Duration((1-room/float64(previous))*float64(limit.Window)) - elapsed
+	}
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return false, retryAfter
+}
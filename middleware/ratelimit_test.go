@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/go-chi/chi"
+)
+
+func TestRoutePattern(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/api/v1/jobs/abc", want: "/jobs/{code}"},
+		{path: "/api/v1/users", want: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			sub := chi.NewRouter()
+			l := NewRateLimiter(sub, RateLimit{})
+			got := ""
+			sub.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					got = l.routePattern(r)
+					next.ServeHTTP(w, r)
+				})
+			})
+			sub.Get("/jobs/{code}", func(http.ResponseWriter, *http.Request) {})
+			r := chi.NewRouter()
+			r.Mount("/api/v1", sub)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+			if got != tt.want {
+				t.Errorf("routePattern = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	limit := RateLimit{Requests: 10, Window: time.Minute}
+	tests := []struct {
+		name       string
+		previous   int
+		current    int
+		elapsed    time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{name: "empty windows", allowed: true},
+		{name: "last request of the window", current: 9, allowed: true},
+		{name: "window full", current: 10, elapsed: 30 * time.Second, retryAfter: 30 * time.Second},
+		{name: "previous window weighted", previous: 10, elapsed: 30 * time.Second, allowed: true},
+		{name: "previous window fills the limit", previous: 10, current: 4, elapsed: 30 * time.Second, allowed: true},
+		{name: "previous window weight exceeds", previous: 10, current: 5, elapsed: 30 * time.Second, retryAfter: 6 * time.Second},
+		{name: "minimum retry", previous: 20, current: 9, elapsed: 59500 * time.Millisecond, retryAfter: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, retryAfter := decide(tt.previous, tt.current, limit, tt.elapsed)
+			if allowed != tt.allowed || retryAfter != tt.retryAfter {
+				t.Errorf("decide = %v %v, want %v %v", allowed, retryAfter, tt.allowed, tt.retryAfter)
+			}
+		})
+	}
+}
+
+// fakeRedis answers every command with the reply and sends the command arguments to the channel
+func fakeRedis(t *testing.T, reply string) chan []string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := make(chan []string, 8)
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				r := bufio.NewReader(nc)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := []string{}
+					for i := 0; i < n; i++ {
+						size, _ := r.ReadString('\n')
+						length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+						arg := make([]byte, length+2)
+						io.ReadFull(r, arg)
+						args = append(args, string(arg[:length]))
+					}
+					commands <- args
+					nc.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	redis.Init(addr.IP.String(), addr.Port, "")
+	t.Cleanup(func() {
+		redis.Close()
+		ln.Close()
+	})
+	return commands
+}
+
+func TestCount(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 30, 0, time.UTC)
+	user := newRateLimitWindow("ratelimit:/jobs", rateLimitSubject{key: "user:bob", limit: RateLimit{Requests: 10, Window: time.Minute}}, now)
+	module := newRateLimitWindow("ratelimit:/jobs", rateLimitSubject{key: "module:core", limit: RateLimit{Requests: 100, Window: time.Minute}}, now)
+	tests := []struct {
+		name       string
+		reply      string
+		denied     string
+		retryAfter time.Duration
+		wantErr    bool
+	}{
+		{name: "allowed", reply: "*5\r\n:1\r\n:0\r\n:3\r\n:0\r\n:3\r\n"},
+		{name: "user limit", reply: "*5\r\n:0\r\n:10\r\n:5\r\n:0\r\n:3\r\n", denied: "user:bob", retryAfter: 6 * time.Second},
+		{name: "module limit", reply: "*5\r\n:0\r\n:0\r\n:3\r\n:0\r\n:100\r\n", denied: "module:core", retryAfter: 30 * time.Second},
+		{name: "unexpected reply", reply: "*1\r\n:0\r\n", wantErr: true},
+		{name: "script error", reply: "-NOSCRIPT\r\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands := fakeRedis(t, tt.reply)
+			denied, retryAfter, err := countRequest([]rateLimitWindow{user, module})
+			if (err != nil) != tt.wantErr || denied != tt.denied || retryAfter != tt.retryAfter {
+				t.Fatalf("countRequest = %q %v %v, want %q %v", denied, retryAfter, err, tt.denied, tt.retryAfter)
+			}
+			sent := <-commands
+			want := []string{"EVAL", rateLimitScript, "4",
+				user.currentKey, user.previousKey, module.currentKey, module.previousKey,
+				"10", "0.5", "120000", "100", "0.5", "120000"}
+			if strings.Join(sent, "|") != strings.Join(want, "|") {
+				t.Errorf("sent %q, want %q", sent, want)
+			}
+		})
+	}
+}
+
+func TestNewRateLimitWindow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 45, 0, time.UTC)
+	w := newRateLimitWindow("ratelimit:*", rateLimitSubject{key: "addr:10.0.0.1", limit: RateLimit{Requests: 1, Window: time.Minute}}, now)
+	window := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	if w.currentKey != fmt.Sprintf("ratelimit:*:addr:10.0.0.1:%d", window.UnixNano()) ||
+		w.previousKey != fmt.Sprintf("ratelimit:*:addr:10.0.0.1:%d", window.Add(-time.Minute).UnixNano()) ||
+		w.elapsed != 45*time.Second {
+		t.Errorf("window = %+v", w)
+	}
+}
+
+func TestCountWithoutLimits(t *testing.T) {
+	denied, retryAfter, err := countRequest(nil)
+	if denied != "" || retryAfter != 0 || err != nil {
+		t.Errorf("countRequest = %q %v %v", denied, retryAfter, err)
+	}
+}
@@ -1,12 +1,65 @@
 package customerror
 
-import "fmt"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
 
-// Error defines the struct to the api error
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Sentinel errors matched with errors.Is by the kind of the custom errors
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation")
+)
+
+// statusKinds defines the kind of the errors created with the status, errors with other
+// status have no kind unless it is defined by WithKind, validation errors by NewValidation
+var statusKinds = map[int]error{
+	http.StatusNotFound:     ErrNotFound,
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusForbidden:    ErrForbidden,
+	http.StatusConflict:     ErrConflict,
+}
+
+// Error defines the struct to the api error, Code is the http status and ErrorCode the
+// application code, when ErrorCode is empty it is the message Key or derived from the status (bad_request)
+//
+// Errors with a Key have the message resolved from the translation catalog with the Params
+// and Kind is the sentinel error matched by errors.Is
 type Error struct {
-	Code         int
-	Scope        string
-	ErrorMessage string
+	Code         int                    `json:"status"`
+	ErrorCode    string                 `json:"code"`
+	Scope        string                 `json:"-"`
+	Key          string                 `json:"-"`
+	Params       map[string]interface{} `json:"-"`
+	ErrorMessage string                 `json:"message"`
+	Details      []FieldError           `json:"details,omitempty"`
+	RequestID    string                 `json:"request_id,omitempty"`
+	Cause        error                  `json:"-"`
+	Kind         error                  `json:"-"`
+	languageCode string
+}
+
+// FieldError defines the error of one field in the request body, Code is the failed rule
+// and Param the rule parameter, the message is resolved from the Key like the error message
+type FieldError struct {
+	Field   string                 `json:"field"`
+	Code    string                 `json:"code"`
+	Param   string                 `json:"param,omitempty"`
+	Key     string                 `json:"-"`
+	Params  map[string]interface{} `json:"-"`
+	Message string                 `json:"message"`
 }
 
 // Error handling error struct to string
@@ -14,16 +67,247 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s << %s", e.Scope, e.ErrorMessage)
 }
 
+// Unwrap returns the cause so the chain can be checked with errors.Is and errors.As
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is matches the sentinel error defined as the error kind
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// MarshalJSON writes the error envelope with the application code, the cause chain
+// is only written by Log so internal messages are not sent to the client
+func (e *Error) MarshalJSON() ([]byte, error) {
+	type envelope Error
+	return json.Marshal(struct {
+		*envelope
+		ErrorCode string `json:"code"`
+	}{
+		envelope:  (*envelope)(e),
+		ErrorCode: e.AppCode(),
+	})
+}
+
+// AppCode returns the application code or the one derived from the status
+func (e *Error) AppCode() string {
+	if e.ErrorCode != "" {
+		return e.ErrorCode
+	}
+	if e.Key != "" {
+		return e.Key
+	}
+	text := http.StatusText(e.Code)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// Causes returns the message of each error in the cause chain, custom errors without
+// the scope and in the language defined by Localize
+func (e *Error) Causes() []string {
+	causes := []string{}
+	for cause := e.Cause; cause != nil; {
+		custom, ok := cause.(*Error)
+		if !ok {
+			causes = append(causes, cause.Error())
+			break
+		}
+		causes = append(causes, custom.message(e.languageCode))
+		cause = custom.Cause
+	}
+	if len(causes) == 0 {
+		return nil
+	}
+	return causes
+}
+
+// WithScope returns a copy of the error with the scope stacked before the current one
+func (e *Error) WithScope(scope string) *Error {
+	scoped := *e
+	scoped.Scope = fmt.Sprintf("%s - %s", scope, e.Scope)
+	scoped.Details = append([]FieldError(nil), e.Details...)
+	return &scoped
+}
+
+// WithKind returns a copy of the error matched by errors.Is with the kind sentinel
+func (e *Error) WithKind(kind error) *Error {
+	kinded := *e
+	kinded.Kind = kind
+	return &kinded
+}
+
+// Localize resolves the message of the error and its details in the language,
+// the causes are resolved when written and errors without key are kept
+func (e *Error) Localize(languageCode string) {
+	e.languageCode = languageCode
+	e.ErrorMessage = e.message(languageCode)
+	for i, detail := range e.Details {
+		if message, found := translation.Message(detail.Key, languageCode, detail.Params); found {
+			e.Details[i].Message = message
+		}
+	}
+}
+
+// message returns the key message in the language or the current message
+func (e *Error) message(languageCode string) string {
+	if e.Key == "" || languageCode == "" {
+		return e.ErrorMessage
+	}
+	if message, found := translation.Message(e.Key, languageCode, e.Params); found {
+		return message
+	}
+	if e.ErrorMessage == "" {
+		return e.Key
+	}
+	return e.ErrorMessage
+}
+
 // New create a new error with scope and the error message
 func New(code int, scope, message string) error {
 	return &Error{
 		Code:         code,
 		Scope:        scope,
 		ErrorMessage: message,
+		Kind:         statusKinds[code],
 	}
 }
 
-// Cast return struct error
+// NewKey create a new error with scope and a catalog message key, the message is resolved
+// in the system language and again in the request language when the response is rendered
+func NewKey(code int, scope, key string, params map[string]interface{}) error {
+	e := &Error{
+		Code:   code,
+		Scope:  scope,
+		Key:    key,
+		Params: params,
+		Kind:   statusKinds[code],
+	}
+	e.Localize(translation.SystemDefaultLanguageCode)
+	return e
+}
+
+// NewValidation create a bad request error with one detail for each field that failed the validator rules
+func NewValidation(scope string, err error) error {
+	fieldErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		if _, invalid := err.(*validator.InvalidValidationError); invalid {
+			e := NewKey(http.StatusBadRequest, scope, "request.invalid_body", nil).(*Error).WithKind(ErrValidation)
+			e.Cause = err
+			return e
+		}
+		return Wrap(http.StatusBadRequest, scope, err).(*Error).WithKind(ErrValidation)
+	}
+
+	e := &Error{
+		Code:  http.StatusBadRequest,
+		Scope: scope,
+		Key:   "request.invalid_body",
+		Kind:  ErrValidation,
+	}
+	for _, fieldError := range fieldErrors {
+		key := "validation." + fieldError.Tag()
+		if _, found := translation.Message(key, translation.SystemDefaultLanguageCode, nil); !found {
+			key = "validation.invalid"
+		}
+		e.Details = append(e.Details, FieldError{
+			Field: fieldPath(fieldError.Namespace()),
+			Code:  fieldError.Tag(),
+			Param: fieldError.Param(),
+			Key:   key,
+			Params: map[string]interface{}{
+				"field": fieldError.Field(),
+				"param": fieldError.Param(),
+			},
+		})
+	}
+	e.Localize(translation.SystemDefaultLanguageCode)
+	return e
+}
+
+// fieldPath removes the struct name from the validator namespace
+func fieldPath(namespace string) string {
+	if strings.HasPrefix(namespace, "[") {
+		return namespace
+	}
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// Wrap create a new error with scope keeping the cause, the message and key of the first custom
+// error in the chain are kept, other errors have the unexpected error message and the cause is only logged
+func Wrap(code int, scope string, cause error) error {
+	custom, ok := As(cause)
+	if !ok {
+		e := &Error{
+			Code:  code,
+			Scope: scope,
+			Key:   "error.unexpected",
+			Cause: cause,
+			Kind:  statusKinds[code],
+		}
+		e.Localize(translation.SystemDefaultLanguageCode)
+		return e
+	}
+	return &Error{
+		Code:         code,
+		Scope:        scope,
+		Key:          custom.Key,
+		Params:       custom.Params,
+		ErrorMessage: custom.ErrorMessage,
+		Cause:        cause,
+		Kind:         statusKinds[code],
+	}
+}
+
+// As returns the first custom error in the chain
+func As(err error) (*Error, bool) {
+	custom := &Error{}
+	if errors.As(err, &custom) {
+		return custom, true
+	}
+	return nil, false
+}
+
+// Status returns the status of the first custom error in the chain or 500 for other errors
+func Status(err error) int {
+	if custom, ok := As(err); ok {
+		return custom.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// Log writes the error with the request logger, server errors are logged as errors and the others as warnings
+func Log(ctx context.Context, err error) {
+	entry := logger.FromContext(ctx)
+	custom, ok := As(err)
+	if !ok {
+		entry.Error(err.Error())
+		return
+	}
+
+	entry = entry.WithFields(logrus.Fields{"code": custom.Code, "scope": custom.Scope})
+	if causes := custom.Causes(); causes != nil {
+		entry = entry.WithField("causes", causes)
+	}
+	if custom.Code < http.StatusInternalServerError {
+		entry.Warn(custom.ErrorMessage)
+		return
+	}
+	entry.Error(custom.ErrorMessage)
+}
+
+// Cast return the first custom error in the chain, other errors are wrapped as internal errors
 func Cast(err error) *Error {
-	return err.(*Error)
+	if err == nil {
+		return nil
+	}
+	if custom, ok := As(err); ok {
+		return custom
+	}
+	return Wrap(http.StatusInternalServerError, "cast", err).(*Error)
 }
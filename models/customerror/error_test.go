@@ -0,0 +1,112 @@
+package customerror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+func TestEnvelope(t *testing.T) {
+	err := Wrap(http.StatusBadRequest, "load", New(http.StatusNotFound, "db", "not found"))
+	custom := err.(*Error)
+	custom.Details = []FieldError{{Field: "code", Code: "required", Message: "code is required"}}
+	custom.RequestID = "abc"
+	b, _ := json.Marshal(err)
+	want := `{"status":400,"message":"not found","details":[{"field":"code","code":"required","message":"code is required"}],"request_id":"abc","code":"bad_request"}`
+	if string(b) != want {
+		t.Fatal(string(b))
+	}
+	unexpected := Wrap(http.StatusInternalServerError, "x", errors.New("pq: relation does not exist")).(*Error)
+	unexpected.Localize("en")
+	b, _ = json.Marshal(unexpected)
+	if string(b) != `{"status":500,"message":"unexpected error, contact the support with the request id","code":"error.unexpected"}` {
+		t.Fatal(string(b))
+	}
+	if causes := unexpected.Causes(); len(causes) != 1 || causes[0] != "pq: relation does not exist" {
+		t.Fatal(causes)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	err := NewKey(http.StatusNotFound, "login", "user.login.not_found", map[string]interface{}{"email": "a@b.c"}).(*Error)
+	if err.ErrorMessage != "usuário não encontrado com o e-mail a@b.c" {
+		t.Fatal(err.ErrorMessage)
+	}
+	wrapped := Wrap(http.StatusBadRequest, "x", err).(*Error)
+	wrapped.Localize("en")
+	if wrapped.ErrorMessage != "user not found with the email a@b.c" || wrapped.Causes()[0] != wrapped.ErrorMessage || err.ErrorMessage == wrapped.ErrorMessage || wrapped.AppCode() != "user.login.not_found" {
+		t.Fatal(wrapped.ErrorMessage, err.ErrorMessage)
+	}
+	missing := NewKey(400, "x", "missing.key", nil).(*Error)
+	if missing.ErrorMessage != "missing.key" {
+		t.Fatal(missing.ErrorMessage)
+	}
+}
+
+func TestChain(t *testing.T) {
+	base := New(http.StatusNotFound, "db", "missing")
+	err := fmt.Errorf("load: %w", base)
+	if custom, ok := As(err); !ok || custom != base || Status(err) != 404 || Status(errors.New("x")) != 500 {
+		t.Fatal("as")
+	}
+	if Cast(nil) != nil || Cast(errors.New("x")).Code != 500 || Cast(err) != base {
+		t.Fatal("cast")
+	}
+	scoped := base.(*Error).WithScope("handler")
+	if scoped.Scope != "handler - db" || base.(*Error).Scope != "db" {
+		t.Fatal(scoped.Scope)
+	}
+	wrapped := Wrap(http.StatusConflict, "x", err).(*Error)
+	if !errors.Is(wrapped, ErrConflict) || !errors.Is(wrapped, ErrNotFound) || wrapped.ErrorMessage != "missing" {
+		t.Fatal(wrapped)
+	}
+}
+
+func TestIs(t *testing.T) {
+	validation := NewValidation("body", errors.New("invalid"))
+	tests := []struct {
+		name  string
+		err   error
+		kinds []error
+	}{
+		{"not found", New(http.StatusNotFound, "db", "missing"), []error{ErrNotFound}},
+		{"wrapped not found", fmt.Errorf("load: %w", New(http.StatusNotFound, "db", "missing")), []error{ErrNotFound}},
+		{"unauthorized", NewKey(http.StatusUnauthorized, "token", "auth.invalid_token", nil), []error{ErrUnauthorized}},
+		{"forbidden", NewKey(http.StatusForbidden, "permission", "auth.permission_denied", nil), []error{ErrForbidden}},
+		{"conflict wrapping not found", Wrap(http.StatusConflict, "x", New(http.StatusNotFound, "db", "missing")), []error{ErrConflict, ErrNotFound}},
+		{"bad request", New(http.StatusBadRequest, "x", "bad"), nil},
+		{"unprocessable", New(http.StatusUnprocessableEntity, "x", "bad"), nil},
+		{"validation", validation, []error{ErrValidation}},
+		{"scoped validation", validation.(*Error).WithScope("handler"), []error{ErrValidation}},
+		{"explicit kind", New(http.StatusUnprocessableEntity, "x", "bad").(*Error).WithKind(ErrValidation), []error{ErrValidation}},
+		{"internal", Wrap(http.StatusInternalServerError, "x", errors.New("boom")), nil},
+	}
+	sentinels := []error{ErrNotFound, ErrUnauthorized, ErrForbidden, ErrConflict, ErrValidation}
+	for _, tt := range tests {
+		for _, sentinel := range sentinels {
+			want := false
+			for _, kind := range tt.kinds {
+				want = want || kind == sentinel
+			}
+			if got := errors.Is(tt.err, sentinel); got != want {
+				t.Errorf("%s: errors.Is %v = %v, want %v", tt.name, sentinel, got, want)
+			}
+		}
+	}
+}
+
+func TestNewValidationInvalidValue(t *testing.T) {
+	var body map[string]interface{}
+	err := validator.New().Struct(&body)
+	e, ok := NewValidation("body", err).(*Error)
+	if !ok {
+		t.Fatalf("error = %#v", err)
+	}
+	if e.Code != http.StatusBadRequest || e.Key != "request.invalid_body" || e.Cause != err || !errors.Is(e, ErrValidation) {
+		t.Errorf("error = %+v", e)
+	}
+}
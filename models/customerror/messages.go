@@ -0,0 +1,143 @@
+package customerror
+
+import "github.com/agile-work/srv-mdl-shared/models/translation"
+
+// messages defines the catalog of the errors returned by the shared models and middlewares
+var messages = map[string]map[string]string{
+	"error.unexpected": {
+		"pt-br": "erro inesperado, informe o request id ao suporte",
+		"en":    "unexpected error, contact the support with the request id",
+	},
+	"user.login.invalid_body": {
+		"pt-br": "e-mail e senha são obrigatórios",
+		"en":    "email and password are required",
+	},
+	"user.login.not_found": {
+		"pt-br": "usuário não encontrado com o e-mail {email}",
+		"en":    "user not found with the email {email}",
+	},
+	"user.login.invalid_password": {
+		"pt-br": "senha inválida",
+		"en":    "invalid password",
+	},
+	"user.deactivated": {
+		"pt-br": "usuário desativado",
+		"en":    "deactivated user",
+	},
+	"user.not_found": {
+		"pt-br": "usuário não encontrado",
+		"en":    "user not found",
+	},
+	"user.update.no_columns": {
+		"pt-br": "nenhuma coluna para atualizar",
+		"en":    "no columns to update",
+	},
+	"auth.invalid_token": {
+		"pt-br": "token inválido",
+		"en":    "invalid token",
+	},
+	"auth.not_authenticated": {
+		"pt-br": "requisição não autenticada",
+		"en":    "request not authenticated",
+	},
+	"auth.permission_denied": {
+		"pt-br": "sem permissão para {feature} - {permission}",
+		"en":    "permission denied to {feature} - {permission}",
+	},
+	"request.invalid_body": {
+		"pt-br": "corpo da requisição inválido",
+		"en":    "invalid request body",
+	},
+	"validation.invalid": {
+		"pt-br": "{field} é inválido",
+		"en":    "{field} is invalid",
+	},
+	"validation.required": {
+		"pt-br": "{field} é obrigatório",
+		"en":    "{field} is required",
+	},
+	"validation.min": {
+		"pt-br": "{field} deve ter no mínimo {param}",
+		"en":    "{field} must be at least {param}",
+	},
+	"validation.max": {
+		"pt-br": "{field} deve ter no máximo {param}",
+		"en":    "{field} must be at most {param}",
+	},
+	"validation.len": {
+		"pt-br": "{field} deve ter tamanho {param}",
+		"en":    "{field} must have length {param}",
+	},
+	"validation.oneof": {
+		"pt-br": "{field} deve ser um de: {param}",
+		"en":    "{field} must be one of: {param}",
+	},
+	"validation.email": {
+		"pt-br": "{field} deve ser um e-mail válido",
+		"en":    "{field} must be a valid email",
+	},
+	"validation.translation_default": {
+		"pt-br": "{field} deve ter a tradução no idioma padrão do sistema",
+		"en":    "{field} must have a translation in the system default language",
+	},
+	"validation.module_code": {
+		"pt-br": "{field} deve ter apenas letras minúsculas, números e _ começando com uma letra",
+		"en":    "{field} must have only lower case letters, numbers and _ starting with a letter",
+	},
+	"validation.job_param_type": {
+		"pt-br": "{field} não é um tipo de parâmetro válido",
+		"en":    "{field} is not a valid parameter type",
+	},
+	"patch.invalid_document": {
+		"pt-br": "documento de alteração inválido",
+		"en":    "invalid patch document",
+	},
+	"patch.invalid_operation": {
+		"pt-br": "operação {op} inválida",
+		"en":    "invalid operation {op}",
+	},
+	"patch.missing_value": {
+		"pt-br": "operação {op} em {path} sem valor",
+		"en":    "operation {op} on {path} without value",
+	},
+	"patch.invalid_path": {
+		"pt-br": "caminho {path} inválido: {reason}",
+		"en":    "invalid path {path}: {reason}",
+	},
+	"patch.test_failed": {
+		"pt-br": "o valor em {path} não é o esperado",
+		"en":    "the value on {path} is not the expected one",
+	},
+	"patch.unknown_field": {
+		"pt-br": "campo {field} não existe",
+		"en":    "field {field} does not exist",
+	},
+	"patch.not_updatable": {
+		"pt-br": "campo {field} não pode ser alterado",
+		"en":    "field {field} can not be changed",
+	},
+	"patch.invalid_value": {
+		"pt-br": "valor inválido para o campo {field}",
+		"en":    "invalid value for the field {field}",
+	},
+	"request.too_many": {
+		"pt-br": "muitas requisições, tente novamente em {seconds} segundos",
+		"en":    "too many requests, try again in {seconds} seconds",
+	},
+	"idempotency.running": {
+		"pt-br": "requisição com esta chave em execução",
+		"en":    "request with this key is running",
+	},
+	"idempotency.key_reused": {
+		"pt-br": "chave já utilizada com outro corpo",
+		"en":    "key already used with a different body",
+	},
+	"idempotency.anonymous": {
+		"pt-br": "chave de idempotência exige uma requisição autenticada",
+		"en":    "idempotency key requires an authenticated request",
+	},
+}
+
+func init() {
+	translation.RegisterCatalog(messages)
+}
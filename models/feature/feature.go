@@ -43,3 +43,15 @@ func Load(path string) (*Features, error) {
 
 	return f, nil
 }
+
+// Get returns the feature by code
+func (f *Features) Get(code string) (Feature, bool) {
+	feature, ok := f.list[code]
+	return feature, ok
+}
+
+// Permission returns the permission name by code
+func (f Feature) Permission(code string) (translation.Translation, bool) {
+	permission, ok := f.Permissions[code]
+	return permission, ok
+}
@@ -1,6 +1,7 @@
 package job
 
 import (
+	"context"
 	"io/ioutil"
 	"time"
 
@@ -10,7 +11,7 @@ import (
 	"github.com/tidwall/gjson"
 )
 
-func importJSONTasks(trs *db.Transaction, id, path string) error {
+func importJSONTasks(ctx context.Context, trs *db.Transaction, id, path string) error {
 	jsonByte, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
@@ -37,7 +38,7 @@ func importJSONTasks(trs *db.Transaction, id, path string) error {
 			UpdatedBy:        "admin",
 			UpdatedAt:        date,
 		}
-		if err := instanceTask.Create(trs); err != nil {
+		if err := instanceTask.Create(ctx, trs); err != nil {
 			return err
 		}
 	}
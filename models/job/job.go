@@ -1,30 +1,36 @@
 package job
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/agile-work/srv-mdl-core/models/dataset"
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/metrics"
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
 	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/agile-work/srv-shared/sql-builder/builder"
 	"github.com/agile-work/srv-shared/sql-builder/db"
+	"github.com/sirupsen/logrus"
 )
 
 // Job defines the struct of this object
 type Job struct {
 	ID          string                  `json:"id" sql:"id"`
 	Code        string                  `json:"code" sql:"code" updatable:"false" validate:"required"`
-	Name        translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required"`
+	Name        translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required,translation_default"`
 	Description translation.Translation `json:"description" sql:"description" field:"jsonb" validate:"required"`
 	JobType     string                  `json:"job_type" sql:"job_type"`
 	ExecTimeout int                     `json:"exec_timeout" sql:"exec_timeout"`
-	Params      []Param                 `json:"parameters" sql:"parameters" field:"jsonb"`
+	Params      []Param                 `json:"parameters" sql:"parameters" field:"jsonb" validate:"dive"`
 	Active      bool                    `json:"active" sql:"active"`
 	CreatedBy   string                  `json:"created_by" sql:"created_by"`
 	CreatedAt   time.Time               `json:"created_at" sql:"created_at"`
@@ -33,19 +39,24 @@ type Job struct {
 }
 
 // Create persists the struct creating a new object in the database
-func (j *Job) Create(trs *db.Transaction, columns ...string) error {
-	id, err := db.InsertStructTx(trs.Tx, constants.TableCoreConfigLanguages, j, columns...)
-	if err != nil {
-		customerror.New(http.StatusInternalServerError, "language create", err.Error())
+func (j *Job) Create(ctx context.Context, trs *db.Transaction, columns ...string) error {
+	var id string
+	if err := tracing.SQL(ctx, "insert", constants.TableCoreJobs, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreJobs, j, columns...)
+		return err
+	}); err != nil {
+		return customerror.New(http.StatusInternalServerError, "job create", err.Error())
 	}
 	j.ID = id
 	return nil
 }
 
 // Load defines only one object from the database
-func (j *Job) Load() error {
-	if err := db.SelectStruct(constants.TableCoreJobs, j, &db.Options{
-		Conditions: builder.Equal("code", j.Code),
+func (j *Job) Load(ctx context.Context) error {
+	if err := tracing.SQL(ctx, "select", constants.TableCoreJobs, func() error {
+		return db.SelectStruct(constants.TableCoreJobs, j, &db.Options{
+			Conditions: builder.Equal("code", j.Code),
+		})
 	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "job load", err.Error())
 	}
@@ -53,11 +64,13 @@ func (j *Job) Load() error {
 }
 
 // Update updates object data in the database
-func (j *Job) Update(trs *db.Transaction, columns []string, translations map[string]string) error {
+func (j *Job) Update(ctx context.Context, trs *db.Transaction, columns []string, translations map[string]string) error {
 	opt := &db.Options{Conditions: builder.Equal("code", j.Code)}
 
 	if len(columns) > 0 {
-		if err := db.UpdateStructTx(trs.Tx, constants.TableCoreJobs, j, opt, strings.Join(columns, ",")); err != nil {
+		if err := tracing.SQL(ctx, "update", constants.TableCoreJobs, func() error {
+			return db.UpdateStructTx(trs.Tx, constants.TableCoreJobs, j, opt, strings.Join(columns, ","))
+		}); err != nil {
 			return customerror.New(http.StatusInternalServerError, "job update", err.Error())
 		}
 	}
@@ -70,7 +83,10 @@ func (j *Job) Update(trs *db.Transaction, columns []string, translations map[str
 			statement.Values(jsonVal)
 		}
 		statement.Where(opt.Conditions)
-		if _, err := trs.Query(statement); err != nil {
+		if err := tracing.SQL(ctx, "update", constants.TableCoreJobs, func() error {
+			_, err := trs.Query(statement)
+			return err
+		}); err != nil {
 			return customerror.New(http.StatusInternalServerError, "job update", err.Error())
 		}
 	}
@@ -79,9 +95,11 @@ func (j *Job) Update(trs *db.Transaction, columns []string, translations map[str
 }
 
 // Delete deletes object from the database
-func (j *Job) Delete(trs *db.Transaction) error {
-	if err := db.DeleteStructTx(trs.Tx, constants.TableCoreJobs, &db.Options{
-		Conditions: builder.Equal("code", j.Code),
+func (j *Job) Delete(ctx context.Context, trs *db.Transaction) error {
+	if err := tracing.SQL(ctx, "delete", constants.TableCoreJobs, func() error {
+		return db.DeleteStructTx(trs.Tx, constants.TableCoreJobs, &db.Options{
+			Conditions: builder.Equal("code", j.Code),
+		})
 	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "job delete", err.Error())
 	}
@@ -97,8 +115,10 @@ func (j *Job) Delete(trs *db.Transaction) error {
 type Jobs []Job
 
 // LoadAll defines all instances from the object
-func (t *Jobs) LoadAll(opt *db.Options) error {
-	if err := db.SelectStruct(constants.TableCoreJobs, t, opt); err != nil {
+func (t *Jobs) LoadAll(ctx context.Context, opt *db.Options) error {
+	if err := tracing.SQL(ctx, "select", constants.TableCoreJobs, func() error {
+		return db.SelectStruct(constants.TableCoreJobs, t, opt)
+	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "jobs load", err.Error())
 	}
 	return nil
@@ -112,6 +132,7 @@ type Instance struct {
 	ExecTimeout            int                    `json:"exec_timeout" sql:"exec_timeout"`
 	Params                 []Param                `json:"parameters" sql:"parameters" field:"jsonb"`
 	Results                map[string]interface{} `json:"results" sql:"results" field:"jsonb"`
+	RequestID              string                 `json:"request_id" sql:"request_id"`
 	WorkflowStepInstanceID string                 `json:"bpm_step_instance_id" sql:"bpm_step_instance_id"`
 	WorkflowStepActionCode string                 `json:"bpm_step_action_code" sql:"bpm_step_action_code"`
 	Status                 string                 `json:"status" sql:"status"`
@@ -123,13 +144,13 @@ type Instance struct {
 	UpdatedAt              time.Time              `json:"updated_at" sql:"updated_at"`
 }
 
-// Create create a new job instance
-func (i *Instance) Create(trs *db.Transaction, owner string, code string, params map[string]interface{}) (string, error) {
+// Create create a new job instance, the request id is taken from the context when not defined
+func (i *Instance) Create(ctx context.Context, trs *db.Transaction, owner string, code string, params map[string]interface{}) (string, error) {
 	job := Job{
 		Code: code,
 	}
 
-	if err := job.Load(); err != nil {
+	if err := job.Load(ctx); err != nil {
 		return "", err
 	}
 
@@ -146,8 +167,38 @@ func (i *Instance) Create(trs *db.Transaction, owner string, code string, params
 	i.CreatedAt = date
 	i.UpdatedBy = owner
 	i.UpdatedAt = date
+	i.setRequestID(ctx)
+
+	var id string
+	err := tracing.SQL(ctx, "insert", constants.TableCoreJobInstances, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreJobInstances, i)
+		return err
+	})
+	metrics.JobInstanceCreated(job.Code, err)
+	if err == nil {
+		logger.FromContext(ctx).WithFields(logrus.Fields{
+			"job_code":     i.JobCode,
+			"job_instance": id,
+			"request_id":   i.RequestID,
+		}).Info("job instance created")
+	}
+	return id, err
+}
 
-	return db.InsertStructTx(trs.Tx, constants.TableCoreJobInstances, i)
+// Context returns the context with the request id of the user action that created the instance,
+// the calls to the tasks exec address with this context forward it
+func (i *Instance) Context(ctx context.Context) context.Context {
+	if i.RequestID == "" {
+		return ctx
+	}
+	return logger.WithRequestID(ctx, i.RequestID)
+}
+
+// setRequestID defines the request id from the context when not defined
+func (i *Instance) setRequestID(ctx context.Context) {
+	if i.RequestID == "" {
+		i.RequestID = logger.RequestID(ctx)
+	}
 }
 
 // fillParameters fill parameters with values
@@ -169,7 +220,7 @@ func (i *Instance) fillParameters(params []Param, values map[string]interface{})
 }
 
 // CreateFromJSON create a new job instance based on a json file
-func (i *Instance) CreateFromJSON(trs *db.Transaction, owner, path string, timeout int, params map[string]interface{}) (string, error) {
+func (i *Instance) CreateFromJSON(ctx context.Context, trs *db.Transaction, owner, path string, timeout int, params map[string]interface{}) (string, error) {
 	id := db.UUID()
 	date := time.Now()
 	i.ID = id
@@ -180,30 +231,65 @@ func (i *Instance) CreateFromJSON(trs *db.Transaction, owner, path string, timeo
 	i.CreatedAt = date
 	i.UpdatedBy = owner
 	i.UpdatedAt = date
+	i.setRequestID(ctx)
 
-	id, err := db.InsertStructTx(trs.Tx, constants.TableCoreJobInstances, i)
+	err := tracing.SQL(ctx, "insert", constants.TableCoreJobInstances, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreJobInstances, i)
+		return err
+	})
+	metrics.JobInstanceCreated("json", err)
 	if err != nil {
 		return "", err
 	}
 
-	if err := importJSONTasks(trs, id, path); err != nil {
+	if err := importJSONTasks(ctx, trs, id, path); err != nil {
 		return "", err
 	}
 
 	i.Status = constants.JobStatusCreated
 	i.UpdatedAt = time.Now()
 
-	if err := db.UpdateStructTx(trs.Tx, constants.TableCoreJobInstances, i, &db.Options{
-		Conditions: builder.Equal("id", i.ID),
-	}, "status", "updated_at"); err != nil {
+	if err := tracing.SQL(ctx, "update", constants.TableCoreJobInstances, func() error {
+		return db.UpdateStructTx(trs.Tx, constants.TableCoreJobInstances, i, &db.Options{
+			Conditions: builder.Equal("id", i.ID),
+		}, "status", "updated_at")
+	}); err != nil {
 		return "", err
 	}
+
+	logger.FromContext(ctx).WithFields(logrus.Fields{
+		"job_instance": id,
+		"path":         path,
+		"request_id":   i.RequestID,
+	}).Info("job instance created from json")
 	return id, nil
 }
 
+var (
+	paramTypesMutex sync.RWMutex
+	paramTypes      = map[string]bool{}
+)
+
+// RegisterParamTypes adds the types a job param can have, the modules executing the jobs register
+// the types they handle and params are only checked after the first type is registered
+func RegisterParamTypes(types ...string) {
+	paramTypesMutex.Lock()
+	defer paramTypesMutex.Unlock()
+	for _, paramType := range types {
+		paramTypes[paramType] = true
+	}
+}
+
+// ValidParamType returns if the type was registered, any type is valid while none is registered
+func ValidParamType(paramType string) bool {
+	paramTypesMutex.RLock()
+	defer paramTypesMutex.RUnlock()
+	return len(paramTypes) == 0 || paramTypes[paramType]
+}
+
 // Param defines the struct of this object
 type Param struct {
-	Type      string `json:"type"`
+	Type      string `json:"type" validate:"required,job_param_type"`
 	Reference string `json:"ref"`
 	Field     string `json:"field"`
 	Key       string `json:"key"`
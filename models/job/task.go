@@ -1,13 +1,17 @@
 package job
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/metrics"
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
 	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/agile-work/srv-shared/sql-builder/builder"
 	"github.com/agile-work/srv-shared/sql-builder/db"
@@ -17,12 +21,12 @@ import (
 type Task struct {
 	ID               string                  `json:"id" sql:"id"`
 	Code             string                  `json:"code" sql:"code"`
-	Name             translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required"`
+	Name             translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required,translation_default"`
 	Description      translation.Translation `json:"description" sql:"description" field:"jsonb"`
 	JobCode          string                  `json:"job_code" sql:"job_code"`
 	TaskSequence     int                     `json:"task_sequence" sql:"task_sequence"`
 	ExecTimeout      int                     `json:"exec_timeout" sql:"exec_timeout"`
-	Params           []Param                 `json:"parameters" sql:"parameters" field:"jsonb"`
+	Params           []Param                 `json:"parameters" sql:"parameters" field:"jsonb" validate:"dive"`
 	ParentCode       string                  `json:"parent_code" sql:"parent_code"`
 	ExecAction       string                  `json:"exec_action" sql:"exec_action"`
 	ExecAddress      string                  `json:"exec_address" sql:"exec_address"`
@@ -39,22 +43,27 @@ type Task struct {
 }
 
 // Create persists the struct creating a new object in the database
-func (t *Task) Create(trs *db.Transaction, columns ...string) error {
-	id, err := db.InsertStructTx(trs.Tx, constants.TableCoreJobTasks, t, columns...)
-	if err != nil {
-		customerror.New(http.StatusInternalServerError, "task create", err.Error())
+func (t *Task) Create(ctx context.Context, trs *db.Transaction, columns ...string) error {
+	var id string
+	if err := tracing.SQL(ctx, "insert", constants.TableCoreJobTasks, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreJobTasks, t, columns...)
+		return err
+	}); err != nil {
+		return customerror.New(http.StatusInternalServerError, "task create", err.Error())
 	}
 	t.ID = id
 	return nil
 }
 
 // Load defines only one object from the database
-func (t *Task) Load() error {
-	if err := db.SelectStruct(constants.TableCoreJobTasks, t, &db.Options{
-		Conditions: builder.And(
-			builder.Equal("job_code", t.JobCode),
-			builder.Equal("code", t.Code),
-		),
+func (t *Task) Load(ctx context.Context) error {
+	if err := tracing.SQL(ctx, "select", constants.TableCoreJobTasks, func() error {
+		return db.SelectStruct(constants.TableCoreJobTasks, t, &db.Options{
+			Conditions: builder.And(
+				builder.Equal("job_code", t.JobCode),
+				builder.Equal("code", t.Code),
+			),
+		})
 	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "task load", err.Error())
 	}
@@ -62,14 +71,16 @@ func (t *Task) Load() error {
 }
 
 // Update updates object data in the database
-func (t *Task) Update(trs *db.Transaction, columns []string, translations map[string]string) error {
+func (t *Task) Update(ctx context.Context, trs *db.Transaction, columns []string, translations map[string]string) error {
 	opt := &db.Options{Conditions: builder.And(
 		builder.Equal("job_code", t.JobCode),
 		builder.Equal("code", t.Code),
 	)}
 
 	if len(columns) > 0 {
-		if err := db.UpdateStructTx(trs.Tx, constants.TableCoreJobTasks, t, opt, strings.Join(columns, ",")); err != nil {
+		if err := tracing.SQL(ctx, "update", constants.TableCoreJobTasks, func() error {
+			return db.UpdateStructTx(trs.Tx, constants.TableCoreJobTasks, t, opt, strings.Join(columns, ","))
+		}); err != nil {
 			return customerror.New(http.StatusInternalServerError, "task update", err.Error())
 		}
 	}
@@ -82,7 +93,10 @@ func (t *Task) Update(trs *db.Transaction, columns []string, translations map[st
 			statement.Values(jsonVal)
 		}
 		statement.Where(opt.Conditions)
-		if _, err := trs.Query(statement); err != nil {
+		if err := tracing.SQL(ctx, "update", constants.TableCoreJobTasks, func() error {
+			_, err := trs.Query(statement)
+			return err
+		}); err != nil {
 			return customerror.New(http.StatusInternalServerError, "task update", err.Error())
 		}
 	}
@@ -91,12 +105,14 @@ func (t *Task) Update(trs *db.Transaction, columns []string, translations map[st
 }
 
 // Delete deletes object from the database
-func (t *Task) Delete(trs *db.Transaction) error {
-	if err := db.DeleteStructTx(trs.Tx, constants.TableCoreJobTasks, &db.Options{
-		Conditions: builder.And(
-			builder.Equal("job_code", t.JobCode),
-			builder.Equal("code", t.Code),
-		),
+func (t *Task) Delete(ctx context.Context, trs *db.Transaction) error {
+	if err := tracing.SQL(ctx, "delete", constants.TableCoreJobTasks, func() error {
+		return db.DeleteStructTx(trs.Tx, constants.TableCoreJobTasks, &db.Options{
+			Conditions: builder.And(
+				builder.Equal("job_code", t.JobCode),
+				builder.Equal("code", t.Code),
+			),
+		})
 	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "task delete", err.Error())
 	}
@@ -107,8 +123,10 @@ func (t *Task) Delete(trs *db.Transaction) error {
 type Tasks []Task
 
 // LoadAll defines all instances from the object
-func (t *Tasks) LoadAll(opt *db.Options) error {
-	if err := db.SelectStruct(constants.TableCoreJobTasks, t, opt); err != nil {
+func (t *Tasks) LoadAll(ctx context.Context, opt *db.Options) error {
+	if err := tracing.SQL(ctx, "select", constants.TableCoreJobTasks, func() error {
+		return db.SelectStruct(constants.TableCoreJobTasks, t, opt)
+	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "tasks load", err.Error())
 	}
 	return nil
@@ -138,11 +156,28 @@ type InstanceTask struct {
 }
 
 // Create persists the struct creating a new object in the database
-func (t *InstanceTask) Create(trs *db.Transaction) error {
-	id, err := db.InsertStructTx(trs.Tx, constants.TableCoreJobTaskInstances, t)
+func (t *InstanceTask) Create(ctx context.Context, trs *db.Transaction) error {
+	var id string
+	err := tracing.SQL(ctx, "insert", constants.TableCoreJobTaskInstances, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreJobTaskInstances, t)
+		return err
+	})
+	metrics.JobTaskInstanceCreated(err)
 	if err != nil {
-		customerror.New(http.StatusInternalServerError, "task instance create", err.Error())
+		return customerror.New(http.StatusInternalServerError, "task instance create", err.Error())
 	}
 	t.ID = id
 	return nil
 }
+
+// Exec calls the task exec address with the payload, the request id and the trace of the
+// context are forwarded so the call is traced with the user action, see Instance.Context
+func (t *InstanceTask) Exec(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(t.ExecAction), t.ExecAddress, strings.NewReader(t.ExecPayload))
+	if err != nil {
+		return nil, customerror.New(http.StatusInternalServerError, "task instance exec", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req)
+	return logger.Client.Do(req)
+}
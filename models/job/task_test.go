@@ -0,0 +1,50 @@
+package job
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+)
+
+func TestInstanceTaskExec(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		ctx       string
+		want      string
+	}{
+		{name: "instance request id", requestID: "action-1", ctx: "other", want: "action-1"},
+		{name: "context request id", ctx: "current", want: "current"},
+		{name: "without request id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, header, body string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, header = r.Method, r.Header.Get(logger.RequestIDHeader)
+				b, _ := ioutil.ReadAll(r.Body)
+				body = string(b)
+			}))
+			defer ts.Close()
+
+			ctx := context.Background()
+			if tt.ctx != "" {
+				ctx = logger.WithRequestID(ctx, tt.ctx)
+			}
+			instance := &Instance{RequestID: tt.requestID}
+			task := &InstanceTask{ExecAction: "post", ExecAddress: ts.URL, ExecPayload: `{"a":1}`}
+			res, err := task.Exec(instance.Context(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if method != http.MethodPost || body != `{"a":1}` || header != tt.want {
+				t.Errorf("method %s body %s request id %q, want %q", method, body, header, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,14 @@
 package module
 
 import (
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
 	"github.com/agile-work/srv-mdl-shared/models/feature"
 	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/agile-work/srv-shared/sql-builder/db"
 )
@@ -14,10 +16,10 @@ import (
 // Module define a new module in the application
 type Module struct {
 	ID          string                  `json:"id" sql:"id" pk:"true"`
-	Code        string                  `json:"code" sql:"code" updatable:"false" validate:"required"`
+	Code        string                  `json:"code" sql:"code" updatable:"false" validate:"required,module_code"`
 	Prefix      string                  `json:"prefix" sql:"prefix" validate:"required"`
 	Status      string                  `json:"status" sql:"status"`
-	Name        translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required"`
+	Name        translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required,translation_default"`
 	Description translation.Translation `json:"description" sql:"description" field:"jsonb"`
 	Version     string                  `json:"version" sql:"version" updatable:"false" validate:"required"`
 	Definitions Definition              `json:"definitions,omitempty" sql:"definitions" updatable:"false" field:"jsonb"`
@@ -36,10 +38,13 @@ type Definition struct {
 }
 
 // Create defines the configuration for a new module
-func (m *Module) Create(trs *db.Transaction) error {
+func (m *Module) Create(ctx context.Context, trs *db.Transaction) error {
 	translation.SetStructTranslationsLanguage(m, "all")
-	id, err := db.InsertStructTx(trs.Tx, constants.TableCoreModules, m)
-	if err != nil {
+	var id string
+	if err := tracing.SQL(ctx, "insert", constants.TableCoreModules, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreModules, m)
+		return err
+	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "module register", err.Error())
 	}
 	m.ID = id
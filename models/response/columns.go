@@ -0,0 +1,172 @@
+package response
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Columns defines the columns of a resource that can be selected, ordered and filtered
+// by the metadata, each one maps the name used by the client to the database column
+//
+// Columns of structs are defined with ColumnsOf and columns of map rows with NewColumns
+type Columns struct {
+	Select   map[string]string
+	Order    map[string]string
+	Filter   map[string]string
+	jsonb    map[string]bool
+	nullable map[string]bool
+	keys     map[string]string
+}
+
+// Column declares a column of a resource loaded as map rows, Name is used by the client and is the
+// row key and Expression is used in the query, like sch.id or sch.data->>'code' in the instances
+//
+// JSONB columns accept jsonb paths when filtered or ordered and Nullable columns can not be ordered by cursor
+type Column struct {
+	Name       string
+	Expression string
+	Select     bool
+	Order      bool
+	Filter     bool
+	JSONB      bool
+	Nullable   bool
+}
+
+// NewColumns returns the declared columns, the expression defaults to the name
+func NewColumns(declared ...Column) Columns {
+	c := newColumns()
+	for _, column := range declared {
+		expression := column.Expression
+		if expression == "" {
+			expression = column.Name
+		}
+		uses := map[string]bool{"select": column.Select, "order": column.Order, "filter": column.Filter}
+		for use, allowed := range uses {
+			if allowed {
+				c.use(use)[column.Name] = expression
+			}
+		}
+		c.jsonb[expression] = column.JSONB
+		c.nullable[expression] = column.Nullable
+		c.keys[expression] = column.Name
+	}
+	return c
+}
+
+// InstanceColumns returns the columns of the schema instances loaded with user.GetSecurityInstances,
+// the id is qualified by the sch alias and the fields are read from the data column
+func InstanceColumns(fields ...string) Columns {
+	declared := []Column{{Name: "id", Expression: "sch.id", Select: true, Order: true, Filter: true}}
+	for _, field := range fields {
+		declared = append(declared, Column{
+			Name:       field,
+			Expression: "sch.data->>" + quoteLiteral(field),
+			Order:      true,
+			Filter:     true,
+			Nullable:   true,
+		})
+	}
+	return NewColumns(declared...)
+}
+
+var columnsCache sync.Map
+
+// ColumnsOf derives the columns from the struct sql and json tags, the client can use both names
+// Fields without sql tag or with metadata:"-" are not allowed, metadata:"select,order,filter"
+// limits what can be done with the field, jsonb fields accept jsonb paths when filtered or ordered
+// and pointer fields or fields with nullable:"true" can not be ordered by cursor
+func ColumnsOf(object interface{}) Columns {
+	t := reflect.TypeOf(object)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if cached, ok := columnsCache.Load(t); ok {
+		return cached.(Columns)
+	}
+
+	c := newColumns()
+	c.addFields(t)
+	columnsCache.Store(t, c)
+	return c
+}
+
+func newColumns() Columns {
+	return Columns{
+		Select:   map[string]string{},
+		Order:    map[string]string{},
+		Filter:   map[string]string{},
+		jsonb:    map[string]bool{},
+		nullable: map[string]bool{},
+		keys:     map[string]string{},
+	}
+}
+
+// use returns the map of the column names allowed in the use (select, order or filter)
+func (c Columns) use(use string) map[string]string {
+	switch use {
+	case "select":
+		return c.Select
+	case "order":
+		return c.Order
+	case "filter":
+		return c.Filter
+	}
+	return nil
+}
+
+// key returns the row key of the column expression, jsonb paths have no key
+func (c Columns) key(expression string) (string, bool) {
+	key, ok := c.keys[expression]
+	return key, ok
+}
+
+// addFields adds the struct fields including the embedded ones
+func (c Columns) addFields(t reflect.Type) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			c.addFields(ft)
+			continue
+		}
+
+		column := field.Tag.Get("sql")
+		metadata := field.Tag.Get("metadata")
+		if column == "" || column == "-" || metadata == "-" {
+			continue
+		}
+
+		names := []string{column}
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" && name != column {
+			names = append(names, name)
+		}
+
+		uses := []string{"select", "order", "filter"}
+		if metadata != "" {
+			uses = strings.Split(metadata, ",")
+		}
+		for _, use := range uses {
+			m := c.use(strings.TrimSpace(use))
+			if m == nil {
+				continue
+			}
+			for _, name := range names {
+				m[name] = column
+			}
+		}
+		c.keys[column] = column
+		if field.Tag.Get("field") == "jsonb" {
+			c.jsonb[column] = true
+		}
+		if field.Type.Kind() == reflect.Ptr || field.Tag.Get("nullable") == "true" {
+			c.nullable[column] = true
+		}
+	}
+}
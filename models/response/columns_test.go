@@ -0,0 +1,171 @@
+package response
+
+import (
+	"net/http"
+	"testing"
+)
+
+type columnsBase struct {
+	CreatedBy string `json:"created_by" sql:"created_by" metadata:"select"`
+}
+
+type columnsResource struct {
+	columnsBase
+	ID       string                 `json:"id" sql:"id"`
+	Name     string                 `json:"name" sql:"full_name"`
+	Password string                 `json:"password" sql:"password" metadata:"-"`
+	Data     map[string]interface{} `json:"data" sql:"data" field:"jsonb" metadata:"select,filter"`
+	Parent   *string                `json:"parent" sql:"parent"`
+	Code     string                 `json:"code" sql:"code" nullable:"true"`
+	Total    int                    `json:"total"`
+}
+
+func TestColumnsOf(t *testing.T) {
+	columns := ColumnsOf(&[]columnsResource{})
+	tests := []struct {
+		name   string
+		use    map[string]string
+		column string
+		want   string
+	}{
+		{name: "select by json name", use: columns.Select, column: "name", want: "full_name"},
+		{name: "select by sql name", use: columns.Select, column: "full_name", want: "full_name"},
+		{name: "order", use: columns.Order, column: "id", want: "id"},
+		{name: "filter", use: columns.Filter, column: "name", want: "full_name"},
+		{name: "embedded select", use: columns.Select, column: "created_by", want: "created_by"},
+		{name: "embedded not ordered", use: columns.Order, column: "created_by"},
+		{name: "jsonb not ordered", use: columns.Order, column: "data"},
+		{name: "jsonb filter", use: columns.Filter, column: "data", want: "data"},
+		{name: "excluded", use: columns.Select, column: "password"},
+		{name: "without sql tag", use: columns.Filter, column: "total"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.use[tt.column]; got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.column, got, tt.want)
+			}
+		})
+	}
+
+	for column, want := range map[string]bool{"data": true, "full_name": false} {
+		if columns.jsonb[column] != want {
+			t.Errorf("jsonb %s = %v", column, columns.jsonb[column])
+		}
+	}
+	for column, want := range map[string]bool{"parent": true, "code": true, "id": false} {
+		if columns.nullable[column] != want {
+			t.Errorf("nullable %s = %v", column, columns.nullable[column])
+		}
+	}
+}
+
+func TestNewColumns(t *testing.T) {
+	columns := NewColumns(
+		Column{Name: "id", Expression: "t.id", Select: true, Order: true, Filter: true},
+		Column{Name: "code", Select: true, Filter: true},
+		Column{Name: "data", Filter: true, JSONB: true, Nullable: true},
+	)
+	tests := []struct {
+		name   string
+		use    map[string]string
+		column string
+		want   string
+	}{
+		{name: "expression", use: columns.Select, column: "id", want: "t.id"},
+		{name: "name as expression", use: columns.Select, column: "code", want: "code"},
+		{name: "not ordered", use: columns.Order, column: "code"},
+		{name: "not selected", use: columns.Select, column: "data"},
+		{name: "jsonb path", use: columns.Filter, column: "data->>a", want: "data->>'a'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := columns.parse(tt.use, tt.column)
+			if tt.want == "" {
+				if errorCode(err) != http.StatusBadRequest {
+					t.Fatalf("parse = %q %v, want a 400", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parse = %q %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+	if key, ok := columns.key("t.id"); !ok || key != "id" {
+		t.Errorf("key t.id = %q %v", key, ok)
+	}
+	if !columns.nullable["data"] || columns.nullable["t.id"] {
+		t.Errorf("nullable = %v", columns.nullable)
+	}
+	m := Metadata{Columns: "id,code"}
+	opt, err := m.GenerateDBOptions(columns)
+	if err != nil || len(opt.Columns) != 2 || opt.Columns[0] != "t.id AS id" || opt.Columns[1] != "code" {
+		t.Errorf("columns = %v %v, want the expression aliased by the row key", opt, err)
+	}
+}
+
+func TestInstanceColumns(t *testing.T) {
+	columns := InstanceColumns("code", "it's")
+	tests := []struct {
+		column   string
+		want     string
+		nullable bool
+	}{
+		{column: "id", want: "sch.id"},
+		{column: "code", want: "sch.data->>'code'", nullable: true},
+		{column: "it's", want: "sch.data->>'it''s'", nullable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			if got := columns.Order[tt.column]; got != tt.want {
+				t.Errorf("order %s = %q, want %q", tt.column, got, tt.want)
+			}
+			if got := columns.Filter[tt.column]; got != tt.want {
+				t.Errorf("filter %s = %q, want %q", tt.column, got, tt.want)
+			}
+			if columns.nullable[tt.want] != tt.nullable {
+				t.Errorf("nullable %s = %v", tt.want, columns.nullable[tt.want])
+			}
+		})
+	}
+}
+
+func TestGenerateWhitelist(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Metadata
+		columns []string
+		invalid bool
+	}{
+		{name: "selected columns", m: Metadata{Columns: "id, name"}, columns: []string{"id", "full_name"}},
+		{name: "order", m: Metadata{Order: []map[string]string{{"name": "DESC"}}}},
+		{name: "select excluded column", m: Metadata{Columns: "id,password"}, invalid: true},
+		{name: "select expression", m: Metadata{Columns: "id,count(*)"}, invalid: true},
+		{name: "order injected column", m: Metadata{Order: []map[string]string{{"id; drop table users": "asc"}}}, invalid: true},
+		{name: "order injected direction", m: Metadata{Order: []map[string]string{{"id": "asc; drop table users"}}}, invalid: true},
+		{name: "order jsonb path of a filter only column", m: Metadata{Order: []map[string]string{{"data->>a": "asc"}}}, invalid: true},
+		{name: "filter excluded column", m: Metadata{Filter: map[string]MetadataFilter{"password": {Operator: "=", Value: "a"}}}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt, err := tt.m.GenerateDBOptions(ColumnsOf(columnsResource{}))
+			if tt.invalid {
+				if errorCode(err) != http.StatusBadRequest {
+					t.Fatalf("GenerateDBOptions error = %v, want a 400", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(opt.Columns) != len(tt.columns) {
+				t.Fatalf("columns = %v, want %v", opt.Columns, tt.columns)
+			}
+			for i := range tt.columns {
+				if opt.Columns[i] != tt.columns[i] {
+					t.Errorf("columns = %v, want %v", opt.Columns, tt.columns)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package response
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/agile-work/srv-shared/sql-builder/builder"
+	"github.com/agile-work/srv-shared/sql-builder/db"
+)
+
+// Cursor directions
+const (
+	cursorNext = "next"
+	cursorPrev = "prev"
+)
+
+// keysetColumn name of the column used to break ties between rows with the same ordered values,
+// the query uses the column expression so it can be qualified (sch.id) in queries with joins
+const keysetColumn = "id"
+
+// orderColumn defines a parsed metadata order, column is used in the query and key to read the row value
+type orderColumn struct {
+	column string
+	key    string
+	desc   bool
+}
+
+// builder returns the order, reversed when reading the previous page
+func (o orderColumn) builder(reverse bool) builder.Builder {
+	if o.desc != reverse {
+		return builder.Desc(o.column)
+	}
+	return builder.Asc(o.column)
+}
+
+// cursor defines the position of the row where a page starts or ends
+type cursor struct {
+	Direction string        `json:"d"`
+	Order     string        `json:"o"`
+	Values    []interface{} `json:"v"`
+}
+
+// keyset keeps the cursor pagination state between GenerateDBOptions and Paginate
+type keyset struct {
+	orders    []orderColumn
+	limit     int
+	direction string
+	first     bool
+}
+
+// paginateByCursor adds the conditions, the order and the limit to read the page after or before the cursor row
+func (m *Metadata) paginateByCursor(opt *db.Options, columns Columns, orders []orderColumn) error {
+	key, ok := columns.Order[keysetColumn]
+	if !ok {
+		return customerror.New(http.StatusBadRequest, "metadata cursor", "resource without id column")
+	}
+	hasKey := false
+	for _, order := range orders {
+		if columns.nullable[order.column] {
+			return customerror.New(http.StatusBadRequest, "metadata cursor", fmt.Sprintf("column %s can be null and can not be used with cursor", order.key))
+		}
+		if _, ok := columns.key(order.column); !ok {
+			return customerror.New(http.StatusBadRequest, "metadata cursor", fmt.Sprintf("jsonb path %s can not be used with cursor", order.column))
+		}
+		hasKey = hasKey || order.column == key
+	}
+	if !hasKey {
+		orders = append(orders, orderColumn{column: key, key: keysetColumn})
+	}
+
+	limit := m.Pagination["limit"]
+	if limit <= 0 {
+		limit = m.Pagination["totalItens"]
+	}
+	if limit <= 0 {
+		return customerror.New(http.StatusBadRequest, "metadata cursor", "pagination limit is required")
+	}
+
+	ks := &keyset{orders: orders, limit: limit, direction: cursorNext, first: m.Cursor == ""}
+	if m.Cursor != "" {
+		c, err := decodeCursor(m.Cursor)
+		if err != nil {
+			return err
+		}
+		if c.Order != orderKey(orders) || len(c.Values) != len(orders) {
+			return customerror.New(http.StatusBadRequest, "metadata cursor", "cursor does not match the order")
+		}
+		ks.direction = c.Direction
+		opt.AddCondition(keysetCondition(orders, c.Values, c.Direction == cursorPrev))
+	}
+
+	for _, order := range orders {
+		opt.AddOrderBy(order.builder(ks.direction == cursorPrev))
+	}
+	opt.Limit = limit + 1
+	opt.Offset = 0
+	m.keyset = ks
+	return nil
+}
+
+// keysetCondition returns the rows after the values in the order, or before when reverse
+// (a > 1) OR (a = 1 AND b > 2) OR (a = 1 AND b = 2 AND id > 3)
+func keysetCondition(orders []orderColumn, values []interface{}, reverse bool) builder.Builder {
+	alternatives := []builder.Builder{}
+	for i, order := range orders {
+		conditions := []builder.Builder{}
+		for j := 0; j < i; j++ {
+			conditions = append(conditions, builder.Equal(orders[j].column, values[j]))
+		}
+		if order.desc != reverse {
+			conditions = append(conditions, builder.LowerThen(order.column, values[i]))
+		} else {
+			conditions = append(conditions, builder.GreaterThen(order.column, values[i]))
+		}
+		alternatives = append(alternatives, builder.And(conditions...))
+	}
+	return builder.Or(alternatives...)
+}
+
+// Paginate should be called with the pointer to the rows loaded with the options from GenerateDBOptions
+// when paginating by cursor, it removes the extra row used to know if there is another page, keeps the
+// rows in the requested order and defines the Next and Prev cursors, rows can be structs or maps
+func (m *Metadata) Paginate(rows interface{}) error {
+	ks := m.keyset
+	if ks == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return customerror.New(http.StatusInternalServerError, "metadata paginate", "rows should be a pointer to a slice")
+	}
+	v = v.Elem()
+
+	hasMore := v.Len() > ks.limit
+	if hasMore {
+		v.Set(v.Slice(0, ks.limit))
+	}
+	if ks.direction == cursorPrev {
+		for i, j := 0, v.Len()-1; i < j; i, j = i+1, j-1 {
+			first, last := v.Index(i).Interface(), v.Index(j).Interface()
+			v.Index(i).Set(reflect.ValueOf(last))
+			v.Index(j).Set(reflect.ValueOf(first))
+		}
+	}
+
+	m.Next, m.Prev = "", ""
+	defer func() {
+		if m.Page != nil {
+			m.Page.HasNext = m.Next != ""
+		}
+	}()
+	if v.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if hasMore || ks.direction == cursorPrev {
+		if m.Next, err = ks.encode(v.Index(v.Len()-1), cursorNext); err != nil {
+			return err
+		}
+	}
+	if (hasMore && ks.direction == cursorPrev) || (ks.direction == cursorNext && !ks.first) {
+		if m.Prev, err = ks.encode(v.Index(0), cursorPrev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Loader defines a list loaded with the db options, like job.Jobs
+type Loader interface {
+	LoadAll(ctx context.Context, opt *db.Options) error
+}
+
+// LoadAll loads the list with the options from GenerateDBOptions and paginates it by cursor,
+// list should be a pointer to a slice
+func (m *Metadata) LoadAll(ctx context.Context, list Loader, opt *db.Options) error {
+	if err := list.LoadAll(ctx, opt); err != nil {
+		return err
+	}
+	return m.Paginate(list)
+}
+
+// SecurityInstances loads the schema instances allowed to the principal with the options from
+// GenerateDBOptions and paginates them by cursor, the options should be generated with InstanceColumns
+func (m *Metadata) SecurityInstances(ctx context.Context, principal *user.Principal, schemaCode string, opt *db.Options, subQuery *builder.Statement, securityFields map[string]map[string]string) ([]map[string]interface{}, error) {
+	rows, err := principal.GetSecurityInstances(ctx, schemaCode, opt, subQuery, securityFields)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Paginate(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// encode returns the cursor with the row values of the ordered columns
+func (ks *keyset) encode(row reflect.Value, direction string) (string, error) {
+	values := []interface{}{}
+	for _, order := range ks.orders {
+		value, ok := columnValue(row, order.key)
+		if !ok {
+			return "", customerror.New(http.StatusBadRequest, "metadata cursor", fmt.Sprintf("column %s not found in the rows and can not be used with cursor", order.key))
+		}
+		values = append(values, value)
+	}
+
+	data, err := json.Marshal(cursor{Direction: direction, Order: orderKey(ks.orders), Values: values})
+	if err != nil {
+		return "", customerror.New(http.StatusInternalServerError, "metadata cursor", err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// columnValue returns the value of the column from a map or from the struct field with the sql tag
+func columnValue(row reflect.Value, column string) (interface{}, bool) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	switch row.Kind() {
+	case reflect.Map:
+		value := row.MapIndex(reflect.ValueOf(column))
+		if !value.IsValid() {
+			return nil, false
+		}
+		return value.Interface(), true
+	case reflect.Struct:
+		for i := 0; i < row.NumField(); i++ {
+			field := row.Type().Field(i)
+			if field.Anonymous {
+				if value, ok := columnValue(row.Field(i), column); ok {
+					return value, true
+				}
+				continue
+			}
+			if field.Tag.Get("sql") == column {
+				return row.Field(i).Interface(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// decodeCursor parses a cursor received from the client
+func decodeCursor(raw string) (cursor, error) {
+	c := cursor{}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || (c.Direction != cursorNext && c.Direction != cursorPrev) {
+		return c, customerror.New(http.StatusBadRequest, "metadata cursor", "invalid cursor")
+	}
+	return c, nil
+}
+
+// orderKey identifies the order a cursor was created with
+func orderKey(orders []orderColumn) string {
+	keys := []string{}
+	for _, order := range orders {
+		direction := "asc"
+		if order.desc {
+			direction = "desc"
+		}
+		keys = append(keys, order.key+" "+direction)
+	}
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,156 @@
+package response
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+)
+
+type cursorResource struct {
+	ID       string  `json:"id" sql:"id"`
+	Name     string  `json:"name" sql:"full_name"`
+	Position int     `json:"position" sql:"position"`
+	Parent   *string `json:"parent" sql:"parent"`
+}
+
+// page returns the rows the database would return for the options from GenerateDBOptions
+func page(t *testing.T, m *Metadata, rows []cursorResource) []cursorResource {
+	opt, err := m.GenerateDBOptions(ColumnsOf(cursorResource{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.Limit != m.Pagination["limit"]+1 || opt.Offset != 0 {
+		t.Fatalf("limit %d offset %d", opt.Limit, opt.Offset)
+	}
+	if m.Cursor == "" {
+		return rows[:minInt(len(rows), opt.Limit)]
+	}
+	c, err := decodeCursor(m.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rows are sorted by position and id, the cursor values are the position and the id
+	position, id := int(c.Values[0].(float64)), c.Values[1].(string)
+	after := func(r cursorResource) bool {
+		return r.Position > position || (r.Position == position && r.ID > id)
+	}
+	selected := []cursorResource{}
+	if c.Direction == cursorNext {
+		for _, r := range rows {
+			if after(r) && len(selected) < opt.Limit {
+				selected = append(selected, r)
+			}
+		}
+		return selected
+	}
+	for i := len(rows) - 1; i >= 0; i-- {
+		if !after(rows[i]) && (rows[i].Position != position || rows[i].ID != id) && len(selected) < opt.Limit {
+			selected = append(selected, rows[i])
+		}
+	}
+	return selected
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func ids(rows []cursorResource) []string {
+	result := []string{}
+	for _, r := range rows {
+		result = append(result, r.ID)
+	}
+	return result
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	rows := []cursorResource{
+		{ID: "a", Position: 1}, {ID: "b", Position: 1}, {ID: "c", Position: 2},
+		{ID: "d", Position: 3}, {ID: "e", Position: 3}, {ID: "f", Position: 4}, {ID: "g", Position: 5},
+	}
+	order := []map[string]string{{"position": "asc"}}
+	steps := []struct {
+		direction string
+		ids       []string
+		next      bool
+		prev      bool
+	}{
+		{"", []string{"a", "b", "c"}, true, false},
+		{cursorNext, []string{"d", "e", "f"}, true, true},
+		{cursorNext, []string{"g"}, false, true},
+		{cursorPrev, []string{"d", "e", "f"}, true, true},
+		{cursorPrev, []string{"a", "b", "c"}, true, false},
+		{cursorNext, []string{"d", "e", "f"}, true, true},
+	}
+
+	m := &Metadata{Pagination: map[string]int{"limit": 3}, Order: order}
+	for i, step := range steps {
+		switch step.direction {
+		case cursorNext:
+			m = &Metadata{Pagination: map[string]int{"limit": 3}, Order: order, Cursor: m.Next}
+		case cursorPrev:
+			m = &Metadata{Pagination: map[string]int{"limit": 3}, Order: order, Cursor: m.Prev}
+		}
+		selected := page(t, m, rows)
+		m.SetTotal(len(rows))
+		if err := m.Paginate(&selected); err != nil {
+			t.Fatal(i, err)
+		}
+		if !reflect.DeepEqual(ids(selected), step.ids) || (m.Next != "") != step.next || (m.Prev != "") != step.prev {
+			t.Fatalf("step %d: got %v next %t prev %t, want %v next %t prev %t", i, ids(selected), m.Next != "", m.Prev != "", step.ids, step.next, step.prev)
+		}
+		if m.Page == nil || m.Page.HasNext != step.next || *m.Page.Pages != 3 {
+			t.Fatalf("step %d: page %+v", i, m.Page)
+		}
+	}
+}
+
+func TestCursorMapRows(t *testing.T) {
+	columns := InstanceColumns("code")
+	m := &Metadata{Pagination: map[string]int{"limit": 1}, Order: []map[string]string{{"id": "desc"}}}
+	opt, err := m.GenerateDBOptions(columns)
+	if err != nil || opt.Limit != 2 {
+		t.Fatal(opt, err)
+	}
+	if len(m.keyset.orders) != 1 || m.keyset.orders[0].column != "sch.id" || m.keyset.orders[0].key != "id" {
+		t.Fatalf("%+v", m.keyset.orders)
+	}
+	rows := []map[string]interface{}{{"id": "2", "code": "b"}, {"id": "1", "code": "a"}}
+	if err := m.Paginate(&rows); err != nil || len(rows) != 1 || m.Next == "" {
+		t.Fatal(rows, m.Next, err)
+	}
+
+	c, err := decodeCursor(m.Next)
+	if err != nil || c.Order != "id desc" || !reflect.DeepEqual(c.Values, []interface{}{"2"}) {
+		t.Fatal(c, err)
+	}
+	next := &Metadata{Pagination: map[string]int{"limit": 1}, Order: []map[string]string{{"id": "desc"}}, Cursor: m.Next}
+	if _, err := next.GenerateDBOptions(columns); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCursorErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata Metadata
+		columns  Columns
+	}{
+		{"nullable column", Metadata{Pagination: map[string]int{"limit": 2}, Order: []map[string]string{{"parent": "asc"}}}, ColumnsOf(cursorResource{})},
+		{"nullable data field", Metadata{Pagination: map[string]int{"limit": 2}, Order: []map[string]string{{"code": "asc"}}}, InstanceColumns("code")},
+		{"without id", Metadata{Pagination: map[string]int{"limit": 2}}, NewColumns(Column{Name: "code", Order: true})},
+		{"invalid cursor", Metadata{Pagination: map[string]int{"limit": 2}, Cursor: "x"}, ColumnsOf(cursorResource{})},
+		{"cursor from another order", Metadata{Pagination: map[string]int{"limit": 2}, Order: []map[string]string{{"name": "asc"}}, Cursor: "eyJkIjoibmV4dCIsIm8iOiJpZCBhc2MiLCJ2IjpbIjEiXX0"}, ColumnsOf(cursorResource{})},
+	}
+	for _, tt := range tests {
+		if _, err := tt.metadata.GenerateDBOptions(tt.columns); customerror.Status(err) != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want a bad request", tt.name, err)
+		}
+	}
+}
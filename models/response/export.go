@@ -0,0 +1,383 @@
+package response
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/agile-work/srv-mdl-shared/tracing"
+	"github.com/agile-work/srv-shared/sql-builder/builder"
+	"github.com/agile-work/srv-shared/sql-builder/db"
+	"github.com/agile-work/srv-shared/util"
+)
+
+// Export formats accepted by the format query or the Accept header
+const (
+	ExportCSV    = "csv"
+	ExportXLSX   = "xlsx"
+	ExportNDJSON = "ndjson"
+)
+
+// exportContentTypes defines the media type of each export format
+var exportContentTypes = map[string]string{
+	ExportCSV:    "text/csv",
+	ExportXLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ExportNDJSON: "application/x-ndjson",
+}
+
+// exportFlushRows number of rows written between each flush to the client
+const exportFlushRows = 100
+
+// exportWriteTimeout time the client has to receive the rows after each flush, the write deadline
+// is extended on each flush so long exports are not cut by the server WriteTimeout
+const exportWriteTimeout = 60 * time.Second
+
+// ExportColumn defines a column in the export, Name is the row key and Label the translated header
+// Translated columns hold a translation object and are exported in the request language
+type ExportColumn struct {
+	Name       string
+	Label      translation.Translation
+	Translated bool
+}
+
+// RowsFunc should call emit for each row read from the database and stop on the first emit error
+type RowsFunc func(emit func(row map[string]interface{}) error) error
+
+// ExportFormat returns the format from the format query or the Accept header, empty means json
+func ExportFormat(req *http.Request) (string, error) {
+	if format := strings.ToLower(req.URL.Query().Get("format")); format != "" {
+		if _, ok := exportContentTypes[format]; !ok && format != "json" {
+			return "", customerror.New(http.StatusBadRequest, "response export format", fmt.Sprintf("invalid format %s", format))
+		}
+		if format == "json" {
+			return "", nil
+		}
+		return format, nil
+	}
+
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.Split(accept, ";")[0])
+		for format, contentType := range exportContentTypes {
+			if strings.EqualFold(mediaType, contentType) {
+				return format, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Export streams the rows in the format as an attachment named by name, rows are written as they
+// are emitted so the list is never loaded in memory, errors before the first row are rendered as
+// an error response and errors after it are only logged because the status was already sent
+//
+// Security filtered instances can be exported with user.StreamSecurityInstances and
+// the tables loaded with LoadAll with QueryRows
+func (r *Response) Export(res http.ResponseWriter, req *http.Request, format, name string, columns []ExportColumn, rows RowsFunc) {
+	e := &exporter{res: res, controller: http.NewResponseController(res), format: format, name: name, columns: columns, languageCode: languageCode(req)}
+	err := rows(e.emit)
+	if err == nil {
+		err = e.close()
+	}
+	if err == nil {
+		return
+	}
+
+	if !e.started() {
+		r.NewError("response export", err)
+		r.Render(res, req)
+		return
+	}
+	customerror.Log(req.Context(), customerror.New(http.StatusInternalServerError, "response export", err.Error()))
+}
+
+// QueryRows returns the table rows selected with the options one by one
+func QueryRows(ctx context.Context, table string, opt *db.Options) RowsFunc {
+	return func(emit func(row map[string]interface{}) error) error {
+		columns := opt.Columns
+		if len(columns) == 0 {
+			columns = []string{"*"}
+		}
+		statement := builder.Select(columns...).From(table)
+		if opt.Conditions != nil {
+			statement.Where(opt.Conditions)
+		}
+		if opt.OrderBy != nil {
+			statement.OrderBy(opt.OrderBy...)
+		}
+		statement.Limit(opt.Limit)
+		statement.Offset(opt.Offset)
+
+		var rows *sql.Rows
+		if err := tracing.SQL(ctx, "select", table, func() (err error) {
+			rows, err = db.Query(statement)
+			return err
+		}); err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			row, err := util.RowToMap(rows)
+			if err != nil {
+				return err
+			}
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	}
+}
+
+// languageCode returns the principal language and falls back to the Content-Language header
+// and then to the system default language
+func languageCode(req *http.Request) string {
+	if principal, ok := user.FromContext(req.Context()); ok {
+		return principal.LanguageCode
+	}
+	if code := req.Header.Get("Content-Language"); code != "" {
+		return code
+	}
+	return translation.SystemDefaultLanguageCode
+}
+
+// exportWriter writes the rows of one format
+type exportWriter interface {
+	write(values []interface{}) error
+	flush() error
+	close() error
+}
+
+// exporter starts the response on the first row so errors before it can still be rendered
+type exporter struct {
+	res          http.ResponseWriter
+	controller   *http.ResponseController
+	format       string
+	name         string
+	columns      []ExportColumn
+	languageCode string
+	writer       exportWriter
+	sent         bool
+	rows         int
+}
+
+func (e *exporter) started() bool {
+	return e.sent
+}
+
+// start sends the headers and writes the column labels
+func (e *exporter) start() error {
+	contentType, ok := exportContentTypes[e.format]
+	if !ok {
+		return customerror.New(http.StatusBadRequest, "response export format", fmt.Sprintf("invalid format %s", e.format))
+	}
+	e.res.Header().Set("Content-Type", contentType)
+	e.res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, e.name, e.format))
+	e.extendDeadline()
+	e.res.WriteHeader(http.StatusOK)
+	e.sent = true
+
+	labels := []interface{}{}
+	names := []string{}
+	for _, column := range e.columns {
+		label := column.Label.GetAvailable(e.languageCode)
+		if label == "" {
+			label = column.Name
+		}
+		labels = append(labels, label)
+		names = append(names, column.Name)
+	}
+
+	switch e.format {
+	case ExportCSV:
+		e.writer = &csvWriter{csv.NewWriter(e.res)}
+	case ExportXLSX:
+		w, err := newXLSXWriter(e.res)
+		if err != nil {
+			return err
+		}
+		e.writer = w
+	case ExportNDJSON:
+		e.writer = &ndjsonWriter{names: names, w: bufio.NewWriter(e.res)}
+		return nil
+	}
+	return e.writer.write(labels)
+}
+
+// emit writes one row with the export columns
+func (e *exporter) emit(row map[string]interface{}) error {
+	if !e.started() {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	values := make([]interface{}, len(e.columns))
+	for i, column := range e.columns {
+		values[i] = exportValue(column, row[column.Name], e.languageCode, e.format != ExportNDJSON)
+	}
+	if err := e.writer.write(values); err != nil {
+		return err
+	}
+
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// flush sends the buffered rows to the client
+func (e *exporter) flush() error {
+	e.extendDeadline()
+	if err := e.writer.flush(); err != nil {
+		return err
+	}
+	if f, ok := e.res.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// close starts an empty export when no row was emitted and finishes the writer
+func (e *exporter) close() error {
+	if !e.started() {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	e.extendDeadline()
+	return e.writer.close()
+}
+
+// extendDeadline moves the write deadline of the connection, writers that do not
+// support deadlines, like the recorders in tests, keep the server timeouts
+func (e *exporter) extendDeadline() {
+	e.controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+}
+
+// exportValue converts database values to values that can be written by the formats,
+// json values are decoded and, when text is set, written as json text
+func exportValue(column ExportColumn, value interface{}, languageCode string, text bool) interface{} {
+	if b, ok := value.([]byte); ok {
+		var decoded interface{}
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			return string(b)
+		}
+		value = decoded
+	}
+
+	if languages, ok := value.(map[string]interface{}); ok && column.Translated {
+		t := translation.Translation{Language: map[string]string{}}
+		for code, label := range languages {
+			t.Language[code] = fmt.Sprint(label)
+		}
+		return t.GetAvailable(languageCode)
+	}
+
+	switch v := value.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case translation.Translation:
+		return v.GetAvailable(languageCode)
+	}
+
+	kind := reflect.ValueOf(value).Kind()
+	if text && (kind == reflect.Map || kind == reflect.Slice || kind == reflect.Struct || kind == reflect.Ptr) {
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(b)
+	}
+	return value
+}
+
+// escapeFormula prefixes with ' the text starting like a formula so spreadsheets show it as text,
+// numbers like -5 or +1 are kept as they are
+func escapeFormula(text string) string {
+	if _, err := strconv.ParseFloat(text, 64); err == nil {
+		return text
+	}
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// csvWriter writes the rows as comma separated values
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+			record[i] = fmt.Sprint(v)
+		default:
+			record[i] = escapeFormula(fmt.Sprint(v))
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) close() error {
+	return c.flush()
+}
+
+// ndjsonWriter writes one json object per line keeping the columns order
+type ndjsonWriter struct {
+	names []string
+	w     *bufio.Writer
+}
+
+func (n *ndjsonWriter) write(values []interface{}) error {
+	n.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		key, err := json.Marshal(n.names[i])
+		if err != nil {
+			return err
+		}
+		val, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		n.w.Write(key)
+		n.w.WriteByte(':')
+		n.w.Write(val)
+	}
+	_, err := n.w.WriteString("}\n")
+	return err
+}
+
+func (n *ndjsonWriter) flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) close() error {
+	return n.w.Flush()
+}
@@ -0,0 +1,204 @@
+package response
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+)
+
+func exportRows(rows ...map[string]interface{}) RowsFunc {
+	return func(emit func(map[string]interface{}) error) error {
+		for _, row := range rows {
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+var exportColumns = []ExportColumn{
+	{Name: "code", Label: translation.Translation{Language: map[string]string{"pt-br": "Código", "en": "Code"}}},
+	{Name: "name", Translated: true},
+	{Name: "total"},
+}
+
+func TestExportFormat(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?format=CSV", nil)
+	if f, err := ExportFormat(req); f != "csv" || err != nil {
+		t.Fatal(f, err)
+	}
+	req = httptest.NewRequest("GET", "/?format=pdf", nil)
+	if _, err := ExportFormat(req); err == nil {
+		t.Fatal("expected error")
+	}
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/json;q=0.9, application/x-ndjson")
+	if f, _ := ExportFormat(req); f != "ndjson" {
+		t.Fatal(f)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Content-Language", "en")
+	res := httptest.NewRecorder()
+	New().Export(res, req, ExportCSV, "users", exportColumns, exportRows(
+		map[string]interface{}{"code": "a,b", "name": []byte(`{"en":"Alpha","pt-br":"Alfa"}`), "total": 3},
+		map[string]interface{}{"code": "c", "total": nil},
+	))
+	want := "Code,name,total\n\"a,b\",Alpha,3\nc,,\n"
+	if res.Body.String() != want || res.Header().Get("Content-Disposition") != `attachment; filename="users.csv"` {
+		t.Fatalf("%q %v", res.Body.String(), res.Header())
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	New().Export(res, req, ExportNDJSON, "users", exportColumns, exportRows(
+		map[string]interface{}{"code": "a", "name": map[string]interface{}{"pt-br": "Alfa"}, "total": []byte(`[1,2]`)},
+	))
+	if res.Body.String() != `{"code":"a","name":"Alfa","total":[1,2]}`+"\n" {
+		t.Fatalf("%q", res.Body.String())
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	New().Export(res, req, ExportXLSX, "users", exportColumns, exportRows(
+		map[string]interface{}{"code": "<a>", "total": 2.5},
+	))
+	sheet := xlsxSheet(t, res.Body.Bytes())
+	if !strings.Contains(sheet, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">&lt;a&gt;</t></is></c><c r="C2"><v>2.5</v></c>`) {
+		t.Fatal(sheet)
+	}
+}
+
+func TestExportWriteTimeout(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		New().Export(w, r, ExportCSV, "users", exportColumns, func(emit func(map[string]interface{}) error) error {
+			for i := 0; i < 3; i++ {
+				if err := emit(map[string]interface{}{"code": "a"}); err != nil {
+					return err
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			return nil
+		})
+	}))
+	ts.Config.WriteTimeout = 20 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil || string(body) != "Código,name,total\na,,\na,,\na,,\n" {
+		t.Fatalf("%q %v", body, err)
+	}
+}
+
+func TestExportError(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	res := httptest.NewRecorder()
+	New().Export(res, req, ExportCSV, "users", exportColumns, func(emit func(map[string]interface{}) error) error {
+		return errors.New("query failed")
+	})
+	if res.Code != http.StatusInternalServerError {
+		t.Fatal(res.Code, res.Body.String())
+	}
+	if xlsxColumn(0) != "A" || xlsxColumn(26) != "AA" || xlsxColumn(701) != "ZZ" {
+		t.Fatal(xlsxColumn(26))
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"alpha", "alpha"},
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+1", "+1"},
+		{"-1", "-1"},
+		{"-5.25", "-5.25"},
+		{"+1e3", "+1e3"},
+		{"-cmd", "'-cmd"},
+		{"+1+cmd", "'+1+cmd"},
+		{"@cmd", "'@cmd"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=b", "a=b"},
+	}
+	for _, tt := range tests {
+		if got := escapeFormula(tt.text); got != tt.want {
+			t.Errorf("escapeFormula(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExportFormula(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		row    map[string]interface{}
+		want   string
+	}{
+		{name: "csv text", format: ExportCSV, row: map[string]interface{}{"code": "=1+2", "total": -3}, want: "'=1+2,,-3\n"},
+		{name: "csv json", format: ExportCSV, row: map[string]interface{}{"code": "@a", "total": []byte(`-4`)}, want: "'@a,,-4\n"},
+		{name: "csv number text", format: ExportCSV, row: map[string]interface{}{"code": "-5", "total": "+1"}, want: "-5,,+1\n"},
+		{name: "xlsx text", format: ExportXLSX, row: map[string]interface{}{"code": "=1+2", "total": -3}, want: `<t xml:space="preserve">=1+2</t></is></c><c r="C2"><v>-3</v></c>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			res := httptest.NewRecorder()
+			New().Export(res, req, tt.format, "users", exportColumns, exportRows(tt.row))
+
+			body := res.Body.String()
+			if tt.format == ExportXLSX {
+				body = xlsxSheet(t, res.Body.Bytes())
+			}
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("export = %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
+
+func xlsxSheet(t *testing.T, b []byte) string {
+	z, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range z.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			r, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			sheet, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(sheet)
+		}
+	}
+	t.Fatal("sheet not found")
+	return ""
+}
@@ -0,0 +1,182 @@
+package response
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-shared/sql-builder/builder"
+)
+
+// identifierRegex defines the valid column and jsonb key names
+var identifierRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetadataFilter defines a condition on a column or a group of conditions joined by And or Or
+//
+// Columns can be a jsonb path like data->>field or data->address->>city, operators:
+//   - =, !=, >, >=, <, <=, like, ilike: a single value
+//   - in, not in: an array of values
+//   - between: an array with two values
+//   - is null, is not null: no value
+type MetadataFilter struct {
+	Column   string           `json:"column,omitempty"`
+	Operator string           `json:"operator,omitempty"`
+	Value    interface{}      `json:"value,omitempty"`
+	And      []MetadataFilter `json:"and,omitempty"`
+	Or       []MetadataFilter `json:"or,omitempty"`
+}
+
+// condition converts the filter in a builder condition validating the column and the operator
+func (f MetadataFilter) condition(columns Columns) (builder.Builder, error) {
+	if len(f.And) > 0 || len(f.Or) > 0 {
+		return f.group(columns)
+	}
+
+	column, err := columns.parse(columns.Filter, f.Column)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(f.Operator) {
+	case "=":
+		return builder.Equal(column, f.Value), nil
+	case "!=":
+		return builder.NotEqual(column, f.Value), nil
+	case ">":
+		return builder.GreaterThen(column, f.Value), nil
+	case ">=":
+		return builder.GreaterOrEqual(column, f.Value), nil
+	case "<":
+		return builder.LowerThen(column, f.Value), nil
+	case "<=":
+		return builder.LowerOrEqual(column, f.Value), nil
+	case "like", "ilike":
+		value, ok := f.Value.(string)
+		if !ok {
+			return nil, filterError(f, "value should be a string")
+		}
+		return builder.Raw(fmt.Sprintf("%s %s %s", column, strings.ToUpper(f.Operator), quoteLiteral(value))), nil
+	case "in", "not in":
+		values, err := literalList(f.Value)
+		if err != nil {
+			return nil, filterError(f, err.Error())
+		}
+		if len(values) == 0 {
+			return nil, filterError(f, "value should not be empty")
+		}
+		return builder.Raw(fmt.Sprintf("%s %s (%s)", column, strings.ToUpper(f.Operator), strings.Join(values, ", "))), nil
+	case "between":
+		values, err := literalList(f.Value)
+		if err != nil {
+			return nil, filterError(f, err.Error())
+		}
+		if len(values) != 2 {
+			return nil, filterError(f, "value should have two items")
+		}
+		return builder.Raw(fmt.Sprintf("%s BETWEEN %s AND %s", column, values[0], values[1])), nil
+	case "is null", "is not null":
+		return builder.Raw(fmt.Sprintf("%s %s", column, strings.ToUpper(f.Operator))), nil
+	}
+	return nil, filterError(f, "invalid operator")
+}
+
+// group converts the And and Or filters, a filter can not have both
+func (f MetadataFilter) group(columns Columns) (builder.Builder, error) {
+	if len(f.And) > 0 && len(f.Or) > 0 {
+		return nil, customerror.New(http.StatusBadRequest, "metadata filter", "group with and and or, use a nested group")
+	}
+
+	filters, join := f.And, builder.And
+	if len(f.Or) > 0 {
+		filters, join = f.Or, builder.Or
+	}
+
+	conditions := []builder.Builder{}
+	for _, filter := range filters {
+		condition, err := filter.condition(columns)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return join(conditions...), nil
+}
+
+// parse validates the column and the jsonb path keys returning the column to be used in the query,
+// the root column should be allowed and jsonb paths are accepted only in jsonb columns
+func (c Columns) parse(allowed map[string]string, column string) (string, error) {
+	path := strings.Split(strings.Replace(column, "->>", "->", -1), "->")
+	root := path[0]
+	if !identifierRegex.MatchString(root) {
+		return "", customerror.New(http.StatusBadRequest, "metadata column", fmt.Sprintf("invalid column %s", column))
+	}
+	dbColumn, ok := allowed[root]
+	if !ok {
+		return "", customerror.New(http.StatusBadRequest, "metadata column", fmt.Sprintf("column %s not allowed", root))
+	}
+	if len(path) == 1 {
+		return dbColumn, nil
+	}
+	if !c.jsonb[dbColumn] {
+		return "", customerror.New(http.StatusBadRequest, "metadata column", fmt.Sprintf("column %s is not jsonb", root))
+	}
+
+	parsed := dbColumn
+	rest := column[len(root):]
+	for _, key := range path[1:] {
+		if !identifierRegex.MatchString(key) {
+			return "", customerror.New(http.StatusBadRequest, "metadata column", fmt.Sprintf("invalid jsonb key %s in %s", key, column))
+		}
+		op := "->"
+		if strings.HasPrefix(rest, "->>") {
+			op = "->>"
+		}
+		parsed += fmt.Sprintf("%s'%s'", op, key)
+		rest = rest[len(op)+len(key):]
+	}
+	return parsed, nil
+}
+
+// literalList returns the array items as sql literals
+func literalList(value interface{}) ([]string, error) {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("value should be an array")
+	}
+	literals := []string{}
+	for _, item := range items {
+		literal, err := literal(item)
+		if err != nil {
+			return nil, err
+		}
+		literals = append(literals, literal)
+	}
+	return literals, nil
+}
+
+// literal returns a json value as a sql literal
+func literal(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return quoteLiteral(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v)), nil
+	}
+	return "", fmt.Errorf("invalid value %v", value)
+}
+
+// quoteLiteral quotes a string escaping the single quotes
+func quoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
+
+func filterError(f MetadataFilter, msg string) error {
+	return customerror.New(http.StatusBadRequest, "metadata filter", fmt.Sprintf("%s %s: %s", f.Column, f.Operator, msg))
+}
@@ -0,0 +1,194 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+)
+
+type filterResource struct {
+	ID     string                 `json:"id" sql:"id"`
+	Name   string                 `json:"name" sql:"full_name"`
+	Secret string                 `json:"secret" sql:"secret" metadata:"-"`
+	Data   map[string]interface{} `json:"data" sql:"data" field:"jsonb" metadata:"select,filter"`
+	Token  string                 `json:"token"`
+}
+
+// errorCode returns the code of a custom error
+func errorCode(err error) int {
+	if custom, ok := err.(*customerror.Error); ok {
+		return custom.Code
+	}
+	return 0
+}
+
+func TestParseJSONBPath(t *testing.T) {
+	columns := ColumnsOf(filterResource{})
+	tests := []struct {
+		column  string
+		want    string
+		invalid bool
+	}{
+		{column: "id", want: "id"},
+		{column: "name", want: "full_name"},
+		{column: "full_name", want: "full_name"},
+		{column: "data->>field", want: "data->>'field'"},
+		{column: "data->field", want: "data->'field'"},
+		{column: "data->address->>city", want: "data->'address'->>'city'"},
+		{column: "data->a->b->>c", want: "data->'a'->'b'->>'c'"},
+		{column: "", invalid: true},
+		{column: "name; drop table users", invalid: true},
+		{column: "data->>'x'", invalid: true},
+		{column: "data->>x'; drop", invalid: true},
+		{column: "data->>", invalid: true},
+		{column: "data->>1x", invalid: true},
+		{column: "id->>x", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.column, func(t *testing.T) {
+			got, err := columns.parse(columns.Filter, tt.column)
+			if tt.invalid {
+				if errorCode(err) != http.StatusBadRequest {
+					t.Fatalf("parse = %q %v, want a 400", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parse = %q %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    string
+		invalid bool
+	}{
+		{name: "string", value: "abc", want: "'abc'"},
+		{name: "quote", value: "b'c", want: "'b''c'"},
+		{name: "injection", value: "x'; drop table users; --", want: "'x''; drop table users; --'"},
+		{name: "backslash", value: `a\'b`, want: `'a\''b'`},
+		{name: "empty string", value: "", want: "''"},
+		{name: "integer", value: float64(42), want: "42"},
+		{name: "decimal", value: 1.5, want: "1.5"},
+		{name: "negative", value: float64(-3), want: "-3"},
+		{name: "int", value: 7, want: "7"},
+		{name: "true", value: true, want: "TRUE"},
+		{name: "false", value: false, want: "FALSE"},
+		{name: "null", value: nil, invalid: true},
+		{name: "object", value: map[string]interface{}{"a": 1}, invalid: true},
+		{name: "array", value: []interface{}{"a"}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := literal(tt.value)
+			if (err != nil) != tt.invalid || got != tt.want {
+				t.Errorf("literal = %q %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiteralList(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    []string
+		invalid bool
+	}{
+		{name: "mixed", value: []interface{}{"a", "b'c", float64(1), true}, want: []string{"'a'", "'b''c'", "1", "TRUE"}},
+		{name: "empty", value: []interface{}{}, want: []string{}},
+		{name: "not an array", value: "a", invalid: true},
+		{name: "invalid item", value: []interface{}{"a", nil}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := literalList(tt.value)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("literalList error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("literalList = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("literalList = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterCondition(t *testing.T) {
+	columns := ColumnsOf(filterResource{})
+	tests := []struct {
+		name    string
+		filter  string
+		invalid bool
+	}{
+		{name: "equal", filter: `{"column":"name","operator":"=","value":"a"}`},
+		{name: "operator case", filter: `{"column":"name","operator":"ILIKE","value":"%a%"}`},
+		{name: "in", filter: `{"column":"id","operator":"in","value":["a","b'c"]}`},
+		{name: "not in", filter: `{"column":"id","operator":"not in","value":[1,2]}`},
+		{name: "between", filter: `{"column":"data->>n","operator":"between","value":[1,2]}`},
+		{name: "is null", filter: `{"column":"data->>n","operator":"is null"}`},
+		{name: "and group", filter: `{"and":[{"column":"id","operator":"=","value":"a"},{"or":[{"column":"name","operator":"is not null"}]}]}`},
+		{name: "like without string", filter: `{"column":"name","operator":"like","value":1}`, invalid: true},
+		{name: "in without array", filter: `{"column":"id","operator":"in","value":"a"}`, invalid: true},
+		{name: "in empty", filter: `{"column":"id","operator":"in","value":[]}`, invalid: true},
+		{name: "between one value", filter: `{"column":"id","operator":"between","value":[1]}`, invalid: true},
+		{name: "between object", filter: `{"column":"id","operator":"between","value":[1,{"a":1}]}`, invalid: true},
+		{name: "unknown operator", filter: `{"column":"id","operator":"~","value":"a"}`, invalid: true},
+		{name: "injected operator", filter: `{"column":"id","operator":"= 1 or 1","value":"1"}`, invalid: true},
+		{name: "column not allowed", filter: `{"column":"secret","operator":"=","value":"a"}`, invalid: true},
+		{name: "and with or", filter: `{"and":[{"column":"id","operator":"is null"}],"or":[{"column":"id","operator":"is null"}]}`, invalid: true},
+		{name: "invalid nested", filter: `{"or":[{"column":"id","operator":"is null"},{"column":"token","operator":"is null"}]}`, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := MetadataFilter{}
+			if err := json.Unmarshal([]byte(tt.filter), &f); err != nil {
+				t.Fatal(err)
+			}
+			_, err := f.condition(columns)
+			if tt.invalid {
+				if errorCode(err) != http.StatusBadRequest {
+					t.Fatalf("condition error = %v, want a 400", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGenerateFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		invalid  bool
+	}{
+		{name: "filter and where", metadata: `{"filter":{"name":{"operator":"in","value":["a","b'c"]}},"where":[{"or":[{"column":"id","operator":"is null"},{"column":"data->>n","operator":"between","value":[1,2]}]}]}`},
+		{name: "invalid where operator", metadata: `{"where":[{"or":[{"column":"id","operator":"~"}]}]}`, invalid: true},
+		{name: "invalid filter column", metadata: `{"filter":{"name;":{"operator":"=","value":"a"}}}`, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Metadata{}
+			if err := json.Unmarshal([]byte(tt.metadata), &m); err != nil {
+				t.Fatal(err)
+			}
+			_, err := m.GenerateDBOptions(ColumnsOf(filterResource{}))
+			if (err != nil) != tt.invalid {
+				t.Errorf("GenerateDBOptions error = %v", err)
+			}
+		})
+	}
+}
@@ -2,7 +2,9 @@ package response
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
@@ -11,18 +13,32 @@ import (
 )
 
 // Metadata defines metadata on the response
+// Filter conditions are joined by and with the Where conditions
+//
+// Pagination by page uses selected and totalItens, pagination by cursor uses limit with the
+// Cursor received in Next or Prev, the first page is requested with limit and without cursor
 type Metadata struct {
 	Filter     map[string]MetadataFilter `json:"filter,omitempty"`
+	Where      []MetadataFilter          `json:"where,omitempty"`
 	Pagination map[string]int            `json:"pagination,omitempty"`
+	Cursor     string                    `json:"cursor,omitempty"`
+	Next       string                    `json:"next,omitempty"`
+	Prev       string                    `json:"prev,omitempty"`
 	Order      []map[string]string       `json:"order,omitempty"`
 	Columns    string                    `json:"columns,omitempty"`
 	Group      string                    `json:"group,omitempty"`
+	SkipCount  bool                      `json:"skipCount,omitempty"`
+	Page       *MetadataPage             `json:"page,omitempty"`
+
+	filters []builder.Builder
+	keyset  *keyset
 }
 
-// MetadataFilter defines filter metadata on the response
-type MetadataFilter struct {
-	Operator string      `json:"operator"`
-	Value    interface{} `json:"value"`
+// MetadataPage defines the pagination result of a list, total and pages are not defined when the count is skipped
+type MetadataPage struct {
+	Total   *int `json:"total,omitempty"`
+	Pages   *int `json:"pages,omitempty"`
+	HasNext bool `json:"hasNext"`
 }
 
 // Load gets metadata from request
@@ -36,46 +52,134 @@ func (m *Metadata) Load(req *http.Request) error {
 	return nil
 }
 
-// GenerateDBOptions convert the metadata in a db options
-func (m *Metadata) GenerateDBOptions() *db.Options {
+// GenerateDBOptions convert the metadata in a db options, only the resource columns
+// can be selected, ordered or filtered, columns should be defined with ColumnsOf
+func (m *Metadata) GenerateDBOptions(columns Columns) (*db.Options, error) {
 	opt := &db.Options{}
 	if m.Columns != "" {
-		opt.Columns = strings.Split(m.Columns, ",")
+		for _, column := range strings.Split(m.Columns, ",") {
+			column, err := columns.parse(columns.Select, strings.TrimSpace(column))
+			if err != nil {
+				return nil, err
+			}
+			if key, ok := columns.key(column); ok && key != column {
+				column = fmt.Sprintf("%s AS %s", column, key)
+			}
+			opt.Columns = append(opt.Columns, column)
+		}
 	}
-	opt.Limit = m.Pagination["totalItens"]
-	opt.Offset = (m.Pagination["selected"] * m.Pagination["totalItens"]) - m.Pagination["totalItens"]
+
+	orders := []orderColumn{}
 	for _, row := range m.Order {
 		for column, order := range row {
-			if order == "asc" {
-				opt.AddOrderBy(builder.Asc(column))
-			} else {
-				opt.AddOrderBy(builder.Desc(column))
+			column, err := columns.parse(columns.Order, column)
+			if err != nil {
+				return nil, err
 			}
+			key, ok := columns.key(column)
+			if !ok {
+				key = column
+			}
+			switch strings.ToLower(order) {
+			case "asc", "desc":
+				orders = append(orders, orderColumn{column: column, key: key, desc: strings.ToLower(order) == "desc"})
+			default:
+				return nil, customerror.New(http.StatusBadRequest, "metadata order", fmt.Sprintf("invalid order %s for column %s", order, column))
+			}
+		}
+	}
+
+	filterColumns := []string{}
+	for column := range m.Filter {
+		filterColumns = append(filterColumns, column)
+	}
+	sort.Strings(filterColumns)
+	m.filters = nil
+	for _, column := range filterColumns {
+		filter := m.Filter[column]
+		filter.Column = column
+		condition, err := filter.condition(columns)
+		if err != nil {
+			return nil, err
 		}
+		m.filters = append(m.filters, condition)
 	}
-	for column, filter := range m.Filter {
-		var condition builder.Builder
-		switch filter.Operator {
-		case "=":
-			condition = builder.Equal(column, filter.Value)
-			break
-		case "!=":
-			condition = builder.NotEqual(column, filter.Value)
-			break
-		case ">":
-			condition = builder.GreaterThen(column, filter.Value)
-			break
-		case ">=":
-			condition = builder.GreaterOrEqual(column, filter.Value)
-			break
-		case "<":
-			condition = builder.LowerThen(column, filter.Value)
-			break
-		case "<=":
-			condition = builder.LowerOrEqual(column, filter.Value)
-			break
+	for _, filter := range m.Where {
+		condition, err := filter.condition(columns)
+		if err != nil {
+			return nil, err
 		}
+		m.filters = append(m.filters, condition)
+	}
+	for _, condition := range m.filters {
+		opt.AddCondition(condition)
+	}
+
+	if m.Cursor != "" || m.Pagination["limit"] > 0 {
+		if err := m.paginateByCursor(opt, columns, orders); err != nil {
+			return nil, err
+		}
+	} else {
+		opt.Limit = m.Pagination["totalItens"]
+		opt.Offset = (m.Pagination["selected"] * m.Pagination["totalItens"]) - m.Pagination["totalItens"]
+		for _, order := range orders {
+			opt.AddOrderBy(order.builder(false))
+		}
+	}
+	return opt, nil
+}
+
+// CountOptions returns the options with the filters from GenerateDBOptions without order and pagination
+func (m *Metadata) CountOptions() *db.Options {
+	opt := &db.Options{}
+	for _, condition := range m.filters {
 		opt.AddCondition(condition)
 	}
 	return opt
 }
+
+// Count counts the table rows with the metadata filters and defines the page, the count is skipped when SkipCount is set
+func (m *Metadata) Count(table string) error {
+	if m.SkipCount {
+		m.SetTotal(-1)
+		return nil
+	}
+	total, err := db.Count("id", table, m.CountOptions())
+	if err != nil {
+		return customerror.New(http.StatusInternalServerError, "metadata count", err.Error())
+	}
+	m.SetTotal(total)
+	return nil
+}
+
+// SetTotal defines the page from the total of rows, a negative total means it was not counted
+// and only the cursor pagination can tell if there is a next page
+func (m *Metadata) SetTotal(total int) {
+	if total < 0 && m.keyset == nil {
+		m.Page = nil
+		return
+	}
+
+	page := &MetadataPage{}
+	size := m.Pagination["totalItens"]
+	if m.keyset != nil {
+		size = m.keyset.limit
+	}
+
+	if total >= 0 {
+		page.Total = &total
+		pages := 1
+		if size > 0 {
+			pages = (total + size - 1) / size
+		}
+		page.Pages = &pages
+	}
+
+	switch {
+	case m.keyset != nil:
+		page.HasNext = m.Next != ""
+	case total >= 0 && size > 0:
+		page.HasNext = m.Pagination["selected"]*size < total
+	}
+	m.Page = page
+}
@@ -0,0 +1,86 @@
+package response
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestSetTotal(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Metadata
+		next    string
+		total   int
+		nilPage bool
+		want    *int
+		pages   *int
+		hasNext bool
+	}{
+		{name: "first page", m: Metadata{Pagination: map[string]int{"selected": 1, "totalItens": 10}}, total: 25, want: intPtr(25), pages: intPtr(3), hasNext: true},
+		{name: "middle page", m: Metadata{Pagination: map[string]int{"selected": 2, "totalItens": 10}}, total: 25, want: intPtr(25), pages: intPtr(3), hasNext: true},
+		{name: "last page", m: Metadata{Pagination: map[string]int{"selected": 3, "totalItens": 10}}, total: 25, want: intPtr(25), pages: intPtr(3)},
+		{name: "exact last page", m: Metadata{Pagination: map[string]int{"selected": 2, "totalItens": 10}}, total: 20, want: intPtr(20), pages: intPtr(2)},
+		{name: "empty", m: Metadata{Pagination: map[string]int{"selected": 1, "totalItens": 10}}, total: 0, want: intPtr(0), pages: intPtr(0)},
+		{name: "without pagination", m: Metadata{}, total: 5, want: intPtr(5), pages: intPtr(1)},
+		{name: "count skipped", m: Metadata{Pagination: map[string]int{"selected": 1, "totalItens": 10}}, total: -1, nilPage: true},
+		{name: "cursor", m: Metadata{Pagination: map[string]int{"limit": 2}}, next: "next", total: 5, want: intPtr(5), pages: intPtr(3), hasNext: true},
+		{name: "cursor last page", m: Metadata{Pagination: map[string]int{"limit": 2}}, total: 5, want: intPtr(5), pages: intPtr(3)},
+		{name: "cursor count skipped", m: Metadata{Pagination: map[string]int{"limit": 2}}, next: "next", total: -1, hasNext: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.m
+			if _, err := m.GenerateDBOptions(ColumnsOf(columnsResource{})); err != nil {
+				t.Fatal(err)
+			}
+			m.Next = tt.next
+			m.SetTotal(tt.total)
+
+			if tt.nilPage {
+				if m.Page != nil {
+					t.Fatalf("page = %+v, want nil", m.Page)
+				}
+				return
+			}
+			if m.Page == nil {
+				t.Fatal("page not defined")
+			}
+			if !equalIntPtr(m.Page.Total, tt.want) || !equalIntPtr(m.Page.Pages, tt.pages) || m.Page.HasNext != tt.hasNext {
+				t.Errorf("page = %s, want total %s pages %s hasNext %v", formatPage(m.Page), formatIntPtr(tt.want), formatIntPtr(tt.pages), tt.hasNext)
+			}
+		})
+	}
+}
+
+func TestCountSkipped(t *testing.T) {
+	m := Metadata{Pagination: map[string]int{"selected": 1, "totalItens": 10}, SkipCount: true, Page: &MetadataPage{}}
+	if err := m.Count("core_users"); err != nil {
+		t.Fatal(err)
+	}
+	if m.Page != nil {
+		t.Errorf("page = %s, want nil", formatPage(m.Page))
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func formatIntPtr(i *int) string {
+	if i == nil {
+		return "nil"
+	}
+	return strconv.Itoa(*i)
+}
+
+func formatPage(p *MetadataPage) string {
+	return fmt.Sprintf("{total %s pages %s hasNext %v}", formatIntPtr(p.Total), formatIntPtr(p.Pages), p.HasNext)
+}
@@ -0,0 +1,145 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+)
+
+type parseItem struct {
+	Code      string `json:"code" validate:"required"`
+	Email     string `json:"email" validate:"omitempty,email"`
+	CreatedBy string `json:"created_by"`
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		object    func() interface{}
+		anonymous bool
+		want      string
+	}{
+		{
+			name:   "valid",
+			body:   `{"code":"a"}`,
+			object: func() interface{} { return &parseItem{} },
+		},
+		{
+			name:   "invalid fields",
+			body:   `{"email":"x"}`,
+			object: func() interface{} { return &parseItem{} },
+			want:   `{"status":400,"message":"invalid request body","details":[{"field":"code","code":"required","message":"code is required"},{"field":"email","code":"email","message":"email must be a valid email"}],"code":"request.invalid_body"}`,
+		},
+		{
+			name:   "null item",
+			body:   `[{"code":"a"},null]`,
+			object: func() interface{} { return &[]*parseItem{} },
+			want:   `{"status":400,"message":"invalid request body","details":[{"field":"[1]","code":"required","message":"[1] is required"}],"code":"request.invalid_body"}`,
+		},
+		{
+			name:   "invalid item",
+			body:   `[{"code":""}]`,
+			object: func() interface{} { return &[]parseItem{} },
+			want:   `{"status":400,"message":"invalid request body","details":[{"field":"[0].code","code":"required","message":"code is required"}],"code":"request.invalid_body"}`,
+		},
+		{
+			name:   "list of values",
+			body:   `["a","b"]`,
+			object: func() interface{} { return &[]string{} },
+		},
+		{
+			name:   "map",
+			body:   `{"code":"a"}`,
+			object: func() interface{} { return &map[string]interface{}{} },
+		},
+		{
+			name:      "without principal",
+			body:      `{"code":"a"}`,
+			object:    func() interface{} { return &parseItem{} },
+			anonymous: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			req.Header.Set("Username", "spoofed")
+			if !tt.anonymous {
+				req = req.WithContext(user.NewContext(req.Context(), user.NewPrincipal(&user.User{Username: "bob"}, "en")))
+			}
+
+			err := New().Parse(req, tt.object())
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			custom, ok := err.(*customerror.Error)
+			if !ok {
+				t.Fatalf("error = %#v", err)
+			}
+			custom.Localize("en")
+			b, _ := json.Marshal(custom)
+			if string(b) != tt.want {
+				t.Errorf("error = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListAudit(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`[{"code":"a"},{"code":"b"}]`))
+	req = req.WithContext(user.NewContext(req.Context(), user.NewPrincipal(&user.User{Username: "bob"}, "en")))
+	items := []*parseItem{}
+	if err := New().Parse(req, &items); err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range items {
+		if item.CreatedBy != "bob" {
+			t.Errorf("items[%d].CreatedBy = %q", i, item.CreatedBy)
+		}
+	}
+}
+
+func TestParseAudit(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *user.Principal
+		want      string
+	}{
+		{name: "principal", principal: user.NewPrincipal(&user.User{Username: "bob"}, "en"), want: "bob"},
+		{name: "without principal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", strings.NewReader(`{"code":"a"}`))
+			req.Header.Set("Username", "spoofed")
+			if tt.principal != nil {
+				req = req.WithContext(user.NewContext(req.Context(), tt.principal))
+			}
+			item := &parseItem{}
+			if err := New().Parse(req, item); err != nil {
+				t.Fatal(err)
+			}
+			if item.CreatedBy != tt.want {
+				t.Errorf("CreatedBy = %q, want %q", item.CreatedBy, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewErrorScope(t *testing.T) {
+	err := customerror.New(404, "db", "missing")
+	for i := 0; i < 2; i++ {
+		r := New()
+		r.NewError("handler", err)
+		if r.Error.(*customerror.Error).Scope != "handler - db" || r.Code != 404 {
+			t.Fatal(r.Error)
+		}
+	}
+}
@@ -2,14 +2,14 @@ package response
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"net/http"
 	"reflect"
 
 	shared "github.com/agile-work/srv-mdl-shared"
+	"github.com/agile-work/srv-mdl-shared/logger"
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
 	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/models/user"
 
 	"github.com/agile-work/srv-mdl-shared/util"
 
@@ -26,50 +26,90 @@ type Response struct {
 
 // Render return a http response
 func (r *Response) Render(res http.ResponseWriter, req *http.Request) {
+	if r.Error != nil {
+		if custom, ok := customerror.As(r.Error); ok && custom.RequestID == "" {
+			custom.RequestID = logger.RequestID(req.Context())
+		}
+		customerror.Log(req.Context(), r.Error)
+		if custom, ok := customerror.As(r.Error); ok {
+			custom.Localize(languageCode(req))
+		}
+	}
 	render.Status(req, r.Code)
 	render.JSON(res, req, r)
 }
 
-// NewError creats a new error in response
+// NewError creats a new error in response with a copy of the error scoped, errors wrapping a custom
+// error keep its status and errors that are not custom errors are wrapped as internal errors
 func (r *Response) NewError(scope string, err error) {
-	if custom, ok := err.(*customerror.Error); ok {
-		custom.Scope = fmt.Sprintf("%s - %s", scope, custom.Scope)
-		r.Code = custom.Code
-		r.Error = err
+	var custom *customerror.Error
+	if direct, ok := err.(*customerror.Error); ok {
+		custom = direct.WithScope(scope)
 	} else {
-		r.Code = http.StatusInternalServerError
-		msg := fmt.Sprintf("%s - %s", scope, err.Error())
-		r.Error = errors.New(msg)
+		custom = customerror.Wrap(customerror.Status(err), scope, err).(*customerror.Error)
 	}
+	r.Code = custom.Code
+	r.Error = custom
 }
 
 // Parse get request body to object and creates a response
+// the audit fields and the translations language are defined by the request principal,
+// requests without one, like the public routes, keep the audit fields empty
 func (r *Response) Parse(req *http.Request, object interface{}) error {
 	r.Code = http.StatusOK
+	username := ""
+	if principal, ok := user.FromContext(req.Context()); ok {
+		username = principal.Username
+	}
 	body, _ := util.GetBody(req)
 	if len(body) > 0 {
-		translation.SetStructTranslationsLanguage(object, req.Header.Get("Content-Language"))
+		if reflect.Indirect(reflect.ValueOf(object)).Kind() == reflect.Struct {
+			translation.SetStructTranslationsLanguage(object, languageCode(req))
+		}
 		err := json.Unmarshal(body, object)
 		if err != nil {
 			return customerror.New(http.StatusBadRequest, "response load unmarshal body", err.Error())
 		}
 		if req.Method == http.MethodPost {
-			o := reflect.ValueOf(object).Elem()
-			if o.Kind() == reflect.Slice {
-				for i := 0; i < o.Len(); i++ {
-					if err := shared.Validate.Struct(o.Index(i)); err != nil {
-						return customerror.New(http.StatusBadRequest, "response load invalid body", err.Error())
-					}
-				}
-			} else {
-				if err := shared.Validate.Struct(object); err != nil {
-					return customerror.New(http.StatusBadRequest, "response load invalid body", err.Error())
-				}
+			if err := validateBody(object); err != nil {
+				return customerror.NewValidation("response load invalid body", err)
 			}
 		}
 	}
 
-	util.SetSchemaAudit(req.Method == http.MethodPost, req.Header.Get("Username"), object)
+	setAudit(req.Method == http.MethodPost, username, object)
+	return nil
+}
+
+// setAudit sets the audit fields of a struct or of each struct in a list
+func setAudit(isCreate bool, username string, object interface{}) {
+	o := reflect.Indirect(reflect.ValueOf(object))
+	switch o.Kind() {
+	case reflect.Struct:
+		util.SetSchemaAudit(isCreate, username, object)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < o.Len(); i++ {
+			item := o.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			if !item.IsNil() && item.Elem().Kind() == reflect.Struct {
+				util.SetSchemaAudit(isCreate, username, item.Interface())
+			}
+		}
+	}
+}
+
+// validateBody validates a struct or each item of a list, null items fail as required
+// and bodies that are not structs, like maps, are not validated
+func validateBody(object interface{}) error {
+	o := reflect.Indirect(reflect.ValueOf(object))
+	switch o.Kind() {
+	case reflect.Slice, reflect.Array:
+		return shared.Validate.Var(o.Interface(), "dive,required")
+	case reflect.Struct:
+		return shared.Validate.Struct(object)
+	}
 	return nil
 }
 
@@ -0,0 +1,71 @@
+package translation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+var (
+	catalogMutex sync.RWMutex
+	catalog      = map[string]Translation{}
+)
+
+// RegisterCatalog adds the messages by key and language code to the catalog, keys already
+// registered are replaced so modules can ship their own messages and override the shared ones
+func RegisterCatalog(messages map[string]map[string]string) {
+	catalogMutex.Lock()
+	defer catalogMutex.Unlock()
+	for key, languages := range messages {
+		t := Translation{Language: map[string]string{}}
+		if current, ok := catalog[key]; ok {
+			for code, message := range current.Language {
+				t.Language[code] = message
+			}
+		}
+		for code, message := range languages {
+			t.Language[code] = message
+		}
+		catalog[key] = t
+	}
+}
+
+// LoadCatalog registers the messages of a json file in the format {"key": {"pt-br": "message"}}
+func LoadCatalog(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("catalog file: %s", err.Error())
+	}
+	messages := map[string]map[string]string{}
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return fmt.Errorf("catalog file parse: %s", err.Error())
+	}
+	RegisterCatalog(messages)
+	return nil
+}
+
+// Message returns the key message in the language falling back to the SystemDefaultLanguageCode,
+// the {name} placeholders are replaced by the params and translation params are resolved in the language
+func Message(key, languageCode string, params map[string]interface{}) (string, bool) {
+	catalogMutex.RLock()
+	t, ok := catalog[key]
+	catalogMutex.RUnlock()
+	if !ok {
+		return "", false
+	}
+
+	message := t.GetAvailable(languageCode)
+	if len(params) == 0 {
+		return message, true
+	}
+	replaces := []string{}
+	for name, value := range params {
+		if param, ok := value.(Translation); ok {
+			value = param.GetAvailable(languageCode)
+		}
+		replaces = append(replaces, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replaces...).Replace(message), true
+}
@@ -1,9 +1,11 @@
 package user
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/agile-work/srv-shared/sql-builder/builder"
 	"github.com/agile-work/srv-shared/sql-builder/db"
@@ -11,28 +13,30 @@ import (
 )
 
 // Login validate credentials and return user token
-func (u *User) Login() error {
+func (u *User) Login(ctx context.Context) error {
 	if u.Email == "" || u.Password == "" {
-		return customerror.New(http.StatusBadRequest, "user login", "invalid credentials body")
+		return customerror.NewKey(http.StatusBadRequest, "user login", "user.login.invalid_body", nil)
 	}
 
 	password := u.Password
-	if err := db.SelectStruct(constants.TableCoreUsers, u, &db.Options{
-		Conditions: builder.Equal("email", u.Email),
+	if err := tracing.SQL(ctx, "select", constants.TableCoreUsers, func() error {
+		return db.SelectStruct(constants.TableCoreUsers, u, &db.Options{
+			Conditions: builder.Equal("email", u.Email),
+		})
 	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "user login load user", err.Error())
 	}
 
 	if u.ID == "" {
-		return customerror.New(http.StatusNotFound, "user login", "user not found with this email")
+		return customerror.NewKey(http.StatusNotFound, "user login", "user.login.not_found", map[string]interface{}{"email": u.Email})
 	}
 
 	if u.Password != password {
-		return customerror.New(http.StatusUnauthorized, "user login", "invalid password")
+		return customerror.NewKey(http.StatusUnauthorized, "user login", "user.login.invalid_password", nil)
 	}
 
 	if !u.Active {
-		return customerror.New(http.StatusUnauthorized, "user login", "deactivated user")
+		return customerror.NewKey(http.StatusUnauthorized, "user login", "user.deactivated", nil)
 	}
 
 	u.Password = ""
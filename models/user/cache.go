@@ -0,0 +1,32 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/metrics"
+	"github.com/agile-work/srv-mdl-shared/tracing"
+	"github.com/agile-work/srv-shared/rdb"
+)
+
+// cacheGet reads the key from redis recording the command metrics and span
+func cacheGet(ctx context.Context, key string) (string, error) {
+	var val string
+	err := tracing.Redis(ctx, "get", key, func() (err error) {
+		start := time.Now()
+		val, err = rdb.Get(key)
+		metrics.ObserveRedis("get", start, err)
+		return err
+	})
+	return val, err
+}
+
+// cacheSet writes the key to redis recording the command metrics and span
+func cacheSet(ctx context.Context, key, val string, expiration time.Duration) error {
+	return tracing.Redis(ctx, "set", key, func() error {
+		start := time.Now()
+		err := rdb.Set(key, val, expiration)
+		metrics.ObserveRedis("set", start, err)
+		return err
+	})
+}
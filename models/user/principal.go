@@ -0,0 +1,46 @@
+package user
+
+import (
+	"context"
+
+	"github.com/agile-work/srv-shared/sql-builder/builder"
+	"github.com/agile-work/srv-shared/sql-builder/db"
+)
+
+// Principal defines the authenticated user of a request
+type Principal struct {
+	Username     string
+	LanguageCode string
+	User         *User
+}
+
+// NewPrincipal returns the principal of a loaded user, the language from the token
+// has precedence over the one saved in the user
+func NewPrincipal(u *User, languageCode string) *Principal {
+	if languageCode == "" {
+		languageCode = u.LanguageCode
+	}
+	return &Principal{
+		Username:     u.Username,
+		LanguageCode: languageCode,
+		User:         u,
+	}
+}
+
+// GetSecurityInstances returns the schema instances allowed to the principal
+func (p *Principal) GetSecurityInstances(ctx context.Context, schemaCode string, opt *db.Options, subQuery *builder.Statement, securityFields map[string]map[string]string) ([]map[string]interface{}, error) {
+	return p.User.GetSecurityInstances(ctx, schemaCode, opt, subQuery, securityFields)
+}
+
+type principalKey struct{}
+
+// NewContext returns a context carrying the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal from the context
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
@@ -1,14 +1,16 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/agile-work/srv-shared/rdb"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 	"github.com/agile-work/srv-shared/util"
 	"github.com/tidwall/gjson"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/agile-work/srv-shared/constants"
 	"github.com/agile-work/srv-shared/sql-builder/builder"
@@ -50,32 +52,98 @@ type securityDefinition struct {
 }
 
 type security struct {
-	Schema map[string]securityDefinition `json:"schema"`
+	Schema   map[string]securityDefinition `json:"schema"`
+	Features map[string]map[string]bool    `json:"features"`
+}
+
+// HasPermission returns if the features of the user security grant the feature permission defined
+// in the module definition, the field permissions of the schemas do not grant feature permissions
+func (u *User) HasPermission(featureCode, permissionCode string) bool {
+	if u.Security == nil {
+		return false
+	}
+	return u.Security.Features[featureCode][permissionCode]
 }
 
 // GetSecurityInstances return the initial statement to make a security query
-func (u *User) GetSecurityInstances(schemaCode string, opt *db.Options, subQuery *builder.Statement, securityFields map[string]map[string]string) ([]map[string]interface{}, error) {
+func (u *User) GetSecurityInstances(ctx context.Context, schemaCode string, opt *db.Options, subQuery *builder.Statement, securityFields map[string]map[string]string) ([]map[string]interface{}, error) {
+	results := []map[string]interface{}{}
+	err := u.StreamSecurityInstances(ctx, schemaCode, opt, subQuery, securityFields, func(row map[string]interface{}) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StreamSecurityInstances calls emit for each instance the user can see, one row at a time, stopping on the first emit error
+func (u *User) StreamSecurityInstances(ctx context.Context, schemaCode string, opt *db.Options, subQuery *builder.Statement, securityFields map[string]map[string]string, emit func(row map[string]interface{}) error) (err error) {
+	ctx, span := tracing.Start(ctx, "user.StreamSecurityInstances",
+		attribute.String("schema_code", schemaCode),
+		attribute.String("username", u.Username),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	securitySchema := u.Security.Schema[schemaCode]
 	securityInstanceSchema := u.SecurityInstances.Schema[schemaCode]
 
-	statement, err := getSecurityStatement(securitySchema, securityInstanceSchema, schemaCode, opt, subQuery)
+	statement, err := getSecurityStatement(ctx, securitySchema, securityInstanceSchema, schemaCode, opt, subQuery)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	rows, err := db.Query(statement)
-	if err != nil {
-		return nil, err
+	var rows *sql.Rows
+	if err := tracing.SQL(ctx, "select", constants.InstancesTablePrefix+schemaCode, func() (err error) {
+		rows, err = db.Query(statement)
+		return err
+	}); err != nil {
+		return err
 	}
 
-	results, err := u.applySecurity(securitySchema, securityInstanceSchema, schemaCode, rows, securityFields)
-	if err != nil {
-		return nil, err
+	_, applySpan := tracing.Start(ctx, "user.applySecurity")
+	total := 0
+	err = u.applySecurity(securitySchema, securityInstanceSchema, schemaCode, rows, securityFields, func(row map[string]interface{}) error {
+		total++
+		return emit(row)
+	})
+	applySpan.SetAttributes(attribute.Int("rows", total))
+	tracing.End(applySpan, err)
+	return err
+}
+
+// CountSecurityInstances counts the schema instances the user can see with the options conditions
+func (u *User) CountSecurityInstances(ctx context.Context, schemaCode string, opt *db.Options, subQuery *builder.Statement) (int, error) {
+	securitySchema := u.Security.Schema[schemaCode]
+	securityInstanceSchema := u.SecurityInstances.Schema[schemaCode]
+
+	statement := builder.Select("COUNT(*) AS total").From(fmt.Sprintf("%s%s AS sch", constants.InstancesTablePrefix, schemaCode))
+	if subQuery != nil {
+		statement.JoinSubQuery("sub", subQuery, builder.Raw("sub.id = sch.id"))
 	}
-	return results, nil
+	loadSecurityTreeJoins(securitySchema, statement)
+	loadSecurityConditions(securitySchema, securityInstanceSchema, statement)
+	if opt.Conditions != nil {
+		statement.Where(opt.Conditions)
+	}
+
+	total := 0
+	err := tracing.SQL(ctx, "count", constants.InstancesTablePrefix+schemaCode, func() error {
+		rows, err := db.Query(statement)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		if rows.Next() {
+			return rows.Scan(&total)
+		}
+		return rows.Err()
+	})
+	return total, err
 }
 
-func getSecurityStatement(securitySchema securityDefinition, securityInstanceSchema securityInstance, schemaCode string, opt *db.Options, subQuery *builder.Statement) (*builder.Statement, error) {
+func getSecurityStatement(ctx context.Context, securitySchema securityDefinition, securityInstanceSchema securityInstance, schemaCode string, opt *db.Options, subQuery *builder.Statement) (*builder.Statement, error) {
 	schemaTable := fmt.Sprintf("%s%s AS sch", constants.InstancesTablePrefix, schemaCode)
 	columns := []string{}
 	statement := &builder.Statement{}
@@ -97,7 +165,7 @@ func getSecurityStatement(securitySchema securityDefinition, securityInstanceSch
 		if columnsJSON[0] == "*" {
 			columnsJSON = []string{}
 			// TODO: Tratar o erro no redis
-			rdbSchemaDefFields, _ := rdb.Get("schema:def:contract:fields")
+			rdbSchemaDefFields, _ := cacheGet(ctx, "schema:def:contract:fields")
 
 			if rdbSchemaDefFields != "" {
 				fields := gjson.Get(rdbSchemaDefFields, "#.code")
@@ -105,21 +173,25 @@ func getSecurityStatement(securitySchema securityDefinition, securityInstanceSch
 					columnsJSON = append(columnsJSON, field.String())
 				}
 			} else {
-				rows, err := db.Query(
-					builder.Select(
-						"fld.*",
-					).From(
-						fmt.Sprintf("%s AS %s", constants.TableCoreSchemaFields, "fld"),
-					).Join(
-						fmt.Sprintf("%s AS %s", constants.TableCoreSchemas, "sch"),
-						"sch.code = fld.schema_code",
-					).Where(
-						builder.And(
-							builder.Equal("sch.code", schemaCode),
-							builder.Equal("fld.active", true),
+				var rows *sql.Rows
+				err := tracing.SQL(ctx, "select", constants.TableCoreSchemaFields, func() (err error) {
+					rows, err = db.Query(
+						builder.Select(
+							"fld.*",
+						).From(
+							fmt.Sprintf("%s AS %s", constants.TableCoreSchemaFields, "fld"),
+						).Join(
+							fmt.Sprintf("%s AS %s", constants.TableCoreSchemas, "sch"),
+							"sch.code = fld.schema_code",
+						).Where(
+							builder.And(
+								builder.Equal("sch.code", schemaCode),
+								builder.Equal("fld.active", true),
+							),
 						),
-					),
-				)
+					)
+					return err
+				})
 				if err != nil {
 					return nil, err
 				}
@@ -138,7 +210,7 @@ func getSecurityStatement(securitySchema securityDefinition, securityInstanceSch
 					return nil, err
 				}
 
-				if err := rdb.Set("schema:def:contract:fields", string(jsonBytes), 0); err != nil {
+				if err := cacheSet(ctx, "schema:def:contract:fields", string(jsonBytes), 0); err != nil {
 					return nil, err
 				}
 			}
@@ -211,8 +283,8 @@ func loadSecurityConditions(securitySchema securityDefinition, securityInstanceS
 }
 
 // applySecurity checks the security in the instance columns and clears if user do not have permission
-func (u *User) applySecurity(securitySchema securityDefinition, securityInstanceSchema securityInstance, schemaCode string, rows *sql.Rows, securityFields map[string]map[string]string, columns ...string) ([]map[string]interface{}, error) {
-	results := []map[string]interface{}{}
+func (u *User) applySecurity(securitySchema securityDefinition, securityInstanceSchema securityInstance, schemaCode string, rows *sql.Rows, securityFields map[string]map[string]string, emit func(row map[string]interface{}) error, columns ...string) error {
+	defer rows.Close()
 	schemaFields := map[string]string{}
 	requiredFields := getRequiredFields(securitySchema.SecurityFields)
 	if len(securityFields) > 0 {
@@ -220,13 +292,13 @@ func (u *User) applySecurity(securitySchema securityDefinition, securityInstance
 	}
 	cols, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for rows.Next() {
 		allFields := map[string]bool{}
 		mapJSON, err := util.RowToMap(rows)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		for _, column := range cols {
 			if requiredFields[column] {
@@ -255,11 +327,11 @@ func (u *User) applySecurity(securitySchema securityDefinition, securityInstance
 				}
 			}
 		}
-		results = append(results, getSecurityDataFields(mapJSON, allFields))
+		if err := emit(getSecurityDataFields(mapJSON, allFields)); err != nil {
+			return err
+		}
 	}
-	rows.Close()
-
-	return results, nil
+	return rows.Err()
 }
 
 func getRequiredFields(securityFields map[string]string) map[string]bool {
@@ -1,16 +1,18 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/agile-work/srv-mdl-shared/logger"
 	"github.com/agile-work/srv-mdl-shared/models/customerror"
 	"github.com/agile-work/srv-mdl-shared/models/instance"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 
 	"github.com/agile-work/srv-shared/constants"
-	"github.com/agile-work/srv-shared/rdb"
 	"github.com/agile-work/srv-shared/sql-builder/builder"
 	"github.com/agile-work/srv-shared/sql-builder/db"
 )
@@ -19,8 +21,10 @@ import (
 type Users []User
 
 // LoadAll defines all instances from the object
-func (u *Users) LoadAll(opt *db.Options) error {
-	if err := db.SelectStruct(constants.TableCoreUsers, u, opt); err != nil {
+func (u *Users) LoadAll(ctx context.Context, opt *db.Options) error {
+	if err := tracing.SQL(ctx, "select", constants.TableCoreUsers, func() error {
+		return db.SelectStruct(constants.TableCoreUsers, u, opt)
+	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "users load", err.Error())
 	}
 	return nil
@@ -36,7 +40,7 @@ type User struct {
 	FirstName         string             `json:"first_name" sql:"first_name" validate:"required"`
 	LastName          string             `json:"last_name" sql:"last_name" validate:"required"`
 	Email             string             `json:"email" sql:"email" updatable:"false" validate:"required"`
-	Password          string             `json:"password,omitempty" sql:"password" updatable:"false" validate:"required"`
+	Password          string             `json:"password,omitempty" sql:"password" updatable:"false" metadata:"-" validate:"required"`
 	LanguageCode      string             `json:"language_code" sql:"language_code"`
 	ReceiveEmails     string             `json:"receive_emails" sql:"receive_emails"`
 	Security          *security          `json:"security,omitempty" sql:"security" field:"jsonb"`
@@ -50,9 +54,12 @@ type User struct {
 }
 
 // Create persists the struct creating a new object in the database
-func (u *User) Create(trs *db.Transaction, columns ...string) error {
-	id, err := db.InsertStructTx(trs.Tx, constants.TableCoreUsers, u, columns...)
-	if err != nil {
+func (u *User) Create(ctx context.Context, trs *db.Transaction, columns ...string) error {
+	var id string
+	if err := tracing.SQL(ctx, "insert", constants.TableCoreUsers, func() (err error) {
+		id, err = db.InsertStructTx(trs.Tx, constants.TableCoreUsers, u, columns...)
+		return err
+	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "user create", err.Error())
 	}
 	u.ID = id
@@ -64,22 +71,32 @@ func (u *User) Create(trs *db.Transaction, columns ...string) error {
 	resource.CreatedBy = u.CreatedBy
 	resource.UpdatedAt = u.UpdatedAt
 	resource.UpdatedBy = u.UpdatedBy
-	db.InsertStructTx(trs.Tx, constants.TableCustomResources, &resource)
+	if err := tracing.SQL(ctx, "insert", constants.TableCustomResources, func() error {
+		_, err := db.InsertStructTx(trs.Tx, constants.TableCustomResources, &resource)
+		return err
+	}); err != nil {
+		logger.FromContext(ctx).WithField("username", u.Username).Warnf("user create resource: %s", err.Error())
+	}
 
 	return nil
 }
 
 // Load defines only one object from the database
-func (u *User) Load() error {
-	cache, _ := rdb.Get("instance:user:" + u.Username)
+func (u *User) Load(ctx context.Context) error {
+	cache, err := cacheGet(ctx, "instance:user:"+u.Username)
+	if err != nil {
+		logger.FromContext(ctx).WithField("username", u.Username).Debugf("user load cache: %s", err.Error())
+	}
 
 	if cache != "" {
 		if err := json.Unmarshal([]byte(cache), u); err != nil {
 			return customerror.New(http.StatusInternalServerError, "user parse from cache", err.Error())
 		}
 	} else {
-		if err := db.SelectStruct(constants.TableCoreUsers, u, &db.Options{
-			Conditions: builder.Equal("username", u.Username),
+		if err := tracing.SQL(ctx, "select", constants.TableCoreUsers, func() error {
+			return db.SelectStruct(constants.TableCoreUsers, u, &db.Options{
+				Conditions: builder.Equal("username", u.Username),
+			})
 		}); err != nil {
 			return customerror.New(http.StatusInternalServerError, "user load", err.Error())
 		}
@@ -87,7 +104,7 @@ func (u *User) Load() error {
 		if err != nil {
 			return customerror.New(http.StatusInternalServerError, "user parse to cache", err.Error())
 		}
-		if err := rdb.Set("instance:user:"+u.Username, string(jsonBytes), 0); err != nil {
+		if err := cacheSet(ctx, "instance:user:"+u.Username, string(jsonBytes), 0); err != nil {
 			return customerror.New(http.StatusInternalServerError, "user parse save cache", err.Error())
 		}
 	}
@@ -96,24 +113,28 @@ func (u *User) Load() error {
 }
 
 // Update updates object data in the database
-func (u *User) Update(trs *db.Transaction, columns []string) error {
+func (u *User) Update(ctx context.Context, trs *db.Transaction, columns []string) error {
 	opt := &db.Options{Conditions: builder.Equal("username", u.Username)}
 
 	if len(columns) > 0 {
-		if err := db.UpdateStructTx(trs.Tx, constants.TableCoreUsers, u, opt, strings.Join(columns, ",")); err != nil {
+		if err := tracing.SQL(ctx, "update", constants.TableCoreUsers, func() error {
+			return db.UpdateStructTx(trs.Tx, constants.TableCoreUsers, u, opt, strings.Join(columns, ","))
+		}); err != nil {
 			return customerror.New(http.StatusInternalServerError, "user update", err.Error())
 		}
 	} else {
-		return customerror.New(http.StatusBadRequest, "user update", "no columns to update")
+		return customerror.NewKey(http.StatusBadRequest, "user update", "user.update.no_columns", nil)
 	}
 
 	return nil
 }
 
 // Delete deletes object from the database
-func (u *User) Delete(trs *db.Transaction) error {
-	if err := db.DeleteStructTx(trs.Tx, constants.TableCoreUsers, &db.Options{
-		Conditions: builder.Equal("username", u.Username),
+func (u *User) Delete(ctx context.Context, trs *db.Transaction) error {
+	if err := tracing.SQL(ctx, "delete", constants.TableCoreUsers, func() error {
+		return db.DeleteStructTx(trs.Tx, constants.TableCoreUsers, &db.Options{
+			Conditions: builder.Equal("username", u.Username),
+		})
 	}); err != nil {
 		return customerror.New(http.StatusInternalServerError, "user delete", err.Error())
 	}
@@ -0,0 +1,248 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+)
+
+// Operation defines one RFC 6902 operation, Value is kept raw so a null value can be told from a missing one
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// applyOperations applies the operations in order to the document, the first failure stops the patch
+func applyOperations(doc interface{}, operations []Operation) (interface{}, error) {
+	for _, op := range operations {
+		var err error
+		switch op.Op {
+		case "add":
+			var value interface{}
+			if value, err = op.value(); err == nil {
+				doc, err = add(doc, op.Path, value)
+			}
+		case "remove":
+			doc, _, err = remove(doc, op.Path)
+		case "replace":
+			var value interface{}
+			if value, err = op.value(); err == nil {
+				if doc, _, err = remove(doc, op.Path); err == nil {
+					doc, err = add(doc, op.Path, value)
+				}
+			}
+		case "move":
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, invalidPath(op.Path, "can not move a value into itself")
+			}
+			var value interface{}
+			if doc, value, err = remove(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = get(doc, op.From); err == nil {
+				doc, err = add(doc, op.Path, deepCopy(value))
+			}
+		case "test":
+			var value, expected interface{}
+			if expected, err = op.value(); err == nil {
+				if value, err = get(doc, op.Path); err == nil && !reflect.DeepEqual(value, expected) {
+					return nil, customerror.NewKey(http.StatusConflict, "patch test", "patch.test_failed", map[string]interface{}{"path": op.Path})
+				}
+			}
+		default:
+			return nil, invalid(http.StatusBadRequest, "patch operation", "patch.invalid_operation", map[string]interface{}{"op": op.Op})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// value decodes the operation value, operations that need a value fail without it
+func (o Operation) value() (interface{}, error) {
+	if len(o.Value) == 0 {
+		return nil, invalid(http.StatusBadRequest, "patch operation", "patch.missing_value", map[string]interface{}{"op": o.Op, "path": o.Path})
+	}
+	return decode(o.Value)
+}
+
+// pointer splits a RFC 6901 json pointer in its unescaped tokens
+func pointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, invalidPath(path, "pointer must start with /")
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// get returns the value in the path
+func get(doc interface{}, path string) (interface{}, error) {
+	tokens, err := pointer(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, invalidPath(path, "not found")
+			}
+			doc = value
+		case []interface{}:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, invalidPath(path, err.Error())
+			}
+			doc = node[i]
+		default:
+			return nil, invalidPath(path, "not found")
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value in the path, in arrays the value is inserted at the index or appended with -
+func add(doc interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := pointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, parentPath(path))
+	if err != nil {
+		return nil, err
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i := len(node)
+		if last != "-" {
+			if i, err = index(last, len(node)); err != nil {
+				return nil, invalidPath(path, err.Error())
+			}
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return replaceParent(doc, path, node)
+	}
+	return nil, invalidPath(path, "parent is not an object or array")
+}
+
+// remove deletes the value in the path and returns it
+func remove(doc interface{}, path string) (interface{}, interface{}, error) {
+	tokens, err := pointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, doc, nil
+	}
+	value, err := get(doc, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, _ := get(doc, parentPath(path))
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		i, _ := index(last, len(node)-1)
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = replaceParent(doc, path, node)
+		return doc, value, err
+	}
+	return nil, nil, invalidPath(path, "parent is not an object or array")
+}
+
+// replaceParent sets the array that changed size back in its parent
+func replaceParent(doc interface{}, path string, array []interface{}) (interface{}, error) {
+	parent := parentPath(path)
+	if parent == "" {
+		return array, nil
+	}
+	grandparent, err := get(doc, parentPath(parent))
+	if err != nil {
+		return nil, err
+	}
+	tokens, _ := pointer(parent)
+	last := tokens[len(tokens)-1]
+	switch node := grandparent.(type) {
+	case map[string]interface{}:
+		node[last] = array
+	case []interface{}:
+		i, _ := index(last, len(node)-1)
+		node[i] = array
+	}
+	return doc, nil
+}
+
+func parentPath(path string) string {
+	return path[:strings.LastIndex(path, "/")]
+}
+
+// index parses an array index that must be between 0 and max
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid index %s", token)
+	}
+	if i < 0 || i > max {
+		return 0, fmt.Errorf("index %d out of range", i)
+	}
+	return i, nil
+}
+
+func invalidPath(path, reason string) error {
+	return invalid(http.StatusUnprocessableEntity, "patch path", "patch.invalid_path", map[string]interface{}{"path": path, "reason": reason})
+}
+
+// invalid returns a patch error matched by customerror.ErrValidation
+func invalid(code int, scope, key string, params map[string]interface{}) error {
+	return customerror.NewKey(code, scope, key, params).(*customerror.Error).WithKind(customerror.ErrValidation)
+}
+
+// deepCopy copies the decoded json so copied values do not share maps and arrays
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			c[key] = deepCopy(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = deepCopy(item)
+		}
+		return c
+	}
+	return value
+}
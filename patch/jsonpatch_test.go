@@ -0,0 +1,109 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+)
+
+func TestApplyOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		operations string
+		want       string
+		err        error
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`, nil},
+		{"add array index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/1","value":3}]`, `{"a":[1,3,2]}`, nil},
+		{"add array end", `{"a":[1,2]}`, `[{"op":"add","path":"/a/-","value":3}]`, `{"a":[1,2,3]}`, nil},
+		{"add array after end", `{"a":[1,2]}`, `[{"op":"add","path":"/a/2","value":3}]`, `{"a":[1,2,3]}`, nil},
+		{"add array out of range", `{"a":[1,2]}`, `[{"op":"add","path":"/a/3","value":3}]`, "", customerror.ErrValidation},
+		{"add leading zero index", `{"a":[1,2]}`, `[{"op":"add","path":"/a/01","value":3}]`, "", customerror.ErrValidation},
+		{"add missing parent", `{"a":1}`, `[{"op":"add","path":"/b/c","value":2}]`, "", customerror.ErrValidation},
+		{"add without value", `{"a":1}`, `[{"op":"add","path":"/b"}]`, "", customerror.ErrValidation},
+		{"add null value", `{"a":1}`, `[{"op":"add","path":"/b","value":null}]`, `{"a":1,"b":null}`, nil},
+		{"escaped pointer", `{"a/b":1,"c~d":2}`, `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/c~0d"}]`, `{"a/b":3}`, nil},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`, nil},
+		{"remove array item", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`, nil},
+		{"remove missing", `{"a":[1]}`, `[{"op":"remove","path":"/a/1"}]`, "", customerror.ErrValidation},
+		{"replace array item", `{"a":[1,2,3]}`, `[{"op":"replace","path":"/a/1","value":5}]`, `{"a":[1,5,3]}`, nil},
+		{"replace last array item", `{"a":[1,2,3]}`, `[{"op":"replace","path":"/a/2","value":5}]`, `{"a":[1,2,5]}`, nil},
+		{"replace nested array item", `{"a":[[1,2],[3]]}`, `[{"op":"replace","path":"/a/0/1","value":5}]`, `{"a":[[1,5],[3]]}`, nil},
+		{"replace missing", `{"a":[1]}`, `[{"op":"replace","path":"/b","value":5}]`, "", customerror.ErrValidation},
+		{"replace end of array", `{"a":[1]}`, `[{"op":"replace","path":"/a/-","value":5}]`, "", customerror.ErrValidation},
+		{"replace root", `{"a":1}`, `[{"op":"replace","path":"","value":{"b":2}}]`, `{"b":2}`, nil},
+		{"move array item forward", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/2"}]`, `{"a":[2,3,1]}`, nil},
+		{"move array item back", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/2","path":"/a/0"}]`, `{"a":[3,1,2]}`, nil},
+		{"move between arrays", `{"a":[1,2],"b":[3]}`, `[{"op":"move","from":"/a/0","path":"/b/-"}]`, `{"a":[2],"b":[3,1]}`, nil},
+		{"move member", `{"a":{"x":1},"b":{}}`, `[{"op":"move","from":"/a/x","path":"/b/y"}]`, `{"a":{},"b":{"y":1}}`, nil},
+		{"move into itself", `{"a":[1]}`, `[{"op":"move","from":"/a","path":"/a/0"}]`, "", customerror.ErrValidation},
+		{"copy array item", `{"a":[{"x":1}]}`, `[{"op":"copy","from":"/a/0","path":"/a/-"},{"op":"replace","path":"/a/1/x","value":2}]`, `{"a":[{"x":1},{"x":2}]}`, nil},
+		{"test array", `{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[1,2]}]`, `{"a":[1,2]}`, nil},
+		{"test array item", `{"a":[1,{"b":2}]}`, `[{"op":"test","path":"/a/1","value":{"b":2}}]`, `{"a":[1,{"b":2}]}`, nil},
+		{"test array order", `{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[2,1]}]`, "", customerror.ErrConflict},
+		{"test number", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, "", customerror.ErrConflict},
+		{"test stops the patch", `{"a":1}`, `[{"op":"test","path":"/a","value":2},{"op":"remove","path":"/a"}]`, "", customerror.ErrConflict},
+		{"test missing", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, "", customerror.ErrValidation},
+		{"invalid pointer", `{"a":1}`, `[{"op":"remove","path":"a"}]`, "", customerror.ErrValidation},
+		{"invalid operation", `{"a":1}`, `[{"op":"merge","path":"/a"}]`, "", customerror.ErrValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := decode([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			operations := []Operation{}
+			if err := json.Unmarshal([]byte(tt.operations), &operations); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := applyOperations(doc, operations)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := decode([]byte(tt.want))
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMergePatchDocument(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		target, _ := decode([]byte(tt.target))
+		patch, _ := decode([]byte(tt.patch))
+		want, _ := decode([]byte(tt.want))
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s merged with %s: got %v, want %v", tt.target, tt.patch, got, want)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package patch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	shared "github.com/agile-work/srv-mdl-shared"
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+	"github.com/agile-work/srv-mdl-shared/tracing"
+	"github.com/agile-work/srv-mdl-shared/util"
+	"github.com/agile-work/srv-shared/sql-builder/builder"
+	"github.com/agile-work/srv-shared/sql-builder/db"
+)
+
+// Patch content types, any other content type is read as a merge patch
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// Patch defines a RFC 7396 merge patch or a RFC 6902 json patch to be applied to a model,
+// translation fields accept a string that changes only the patch language
+type Patch struct {
+	merge        interface{}
+	operations   []Operation
+	languageCode string
+	username     string
+}
+
+// Parse reads the patch from the request body by the Content-Type, the language and the
+// audit username are defined by the request principal, without one the language is the
+// Content-Language header and the audit username is empty
+func Parse(req *http.Request) (*Patch, error) {
+	languageCode, username := req.Header.Get("Content-Language"), ""
+	if principal, ok := user.FromContext(req.Context()); ok {
+		languageCode, username = principal.LanguageCode, principal.Username
+	}
+	body, err := util.GetBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var p *Patch
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == JSONPatchContentType {
+		p, err = NewJSONPatch(body)
+	} else {
+		p, err = NewMergePatch(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.languageCode = languageCode
+	p.username = username
+	return p, nil
+}
+
+// NewMergePatch returns a RFC 7396 merge patch, the document must be an object
+func NewMergePatch(data []byte) (*Patch, error) {
+	doc, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, invalid(http.StatusBadRequest, "patch merge", "patch.invalid_document", nil)
+	}
+	return &Patch{merge: doc}, nil
+}
+
+// NewJSONPatch returns a RFC 6902 json patch from the list of operations
+func NewJSONPatch(data []byte) (*Patch, error) {
+	operations := []Operation{}
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return nil, invalid(http.StatusBadRequest, "patch operations", "patch.invalid_document", nil)
+	}
+	return &Patch{operations: operations}, nil
+}
+
+// Language defines the language of the translation fields sent as a string
+func (p *Patch) Language(languageCode string) *Patch {
+	p.languageCode = languageCode
+	return p
+}
+
+// User defines the username written to the updated_by field
+func (p *Patch) User(username string) *Patch {
+	p.username = username
+	return p
+}
+
+// Apply patches the object and validates the result with shared.Validate, the object is only
+// changed when the patch is valid, changes to unknown, updatable:"false", primary key, audit
+// and protected fields are rejected
+func (p *Patch) Apply(object interface{}) (*Update, error) {
+	value := reflect.ValueOf(object)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return nil, customerror.New(http.StatusInternalServerError, "patch apply", "object must be a pointer to a struct")
+	}
+	fields := fieldsOf(value.Elem().Type())
+	languageCode := p.language()
+
+	translation.SetStructTranslationsLanguage(object, "all")
+	defer translation.SetStructTranslationsLanguage(object, p.responseLanguage())
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, customerror.New(http.StatusInternalServerError, "patch apply", err.Error())
+	}
+	original, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	for name, f := range fields {
+		if doc := original.(map[string]interface{}); f.translation && doc[name] == nil {
+			doc[name] = map[string]interface{}{}
+		}
+	}
+
+	var patched interface{}
+	if p.operations != nil {
+		patched, err = applyOperations(deepCopy(original), p.translationOperations(fields, languageCode))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		patched = mergePatch(deepCopy(original), p.translationMerge(fields, languageCode))
+	}
+	result, ok := patched.(map[string]interface{})
+	if !ok {
+		return nil, invalid(http.StatusUnprocessableEntity, "patch apply", "patch.invalid_document", nil)
+	}
+
+	update, target, err := diff(fields, original.(map[string]interface{}), result, value.Elem())
+	if err != nil {
+		return nil, err
+	}
+	update.languageCode = p.responseLanguage()
+	if err := shared.Validate.Struct(target.Addr().Interface()); err != nil {
+		return nil, customerror.NewValidation("patch validate", err)
+	}
+	value.Elem().Set(target)
+
+	if !update.Empty() {
+		util.SetSchemaAudit(false, p.username, object)
+		for _, column := range []string{"updated_by", "updated_at"} {
+			if _, ok := fields.byColumn(column); ok {
+				update.Columns = append(update.Columns, column)
+			}
+		}
+	}
+	return update, nil
+}
+
+// language returns the patch language or the system default
+func (p *Patch) language() string {
+	if p.languageCode == "" || p.languageCode == "all" {
+		return translation.SystemDefaultLanguageCode
+	}
+	return p.languageCode
+}
+
+// responseLanguage returns the language the object translations are written after the patch
+func (p *Patch) responseLanguage() string {
+	if p.languageCode == "" {
+		return translation.FieldsRequestLanguageCode
+	}
+	return p.languageCode
+}
+
+// translationMerge changes the translation fields sent as a string to only the patch language
+func (p *Patch) translationMerge(fields modelFields, languageCode string) interface{} {
+	members := p.merge.(map[string]interface{})
+	result := make(map[string]interface{}, len(members))
+	for key, value := range members {
+		if text, ok := value.(string); ok && fields[key].translation {
+			value = map[string]interface{}{languageCode: text}
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// translationOperations changes the operations that set a translation field with a string to the language path
+func (p *Patch) translationOperations(fields modelFields, languageCode string) []Operation {
+	operations := make([]Operation, len(p.operations))
+	for i, op := range p.operations {
+		tokens, err := pointer(op.Path)
+		if err == nil && len(tokens) == 1 && fields[tokens[0]].translation && (op.Op == "add" || op.Op == "replace") {
+			if text, err := op.value(); err == nil {
+				if _, ok := text.(string); ok {
+					op = Operation{Op: "add", Path: op.Path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(languageCode), Value: op.Value}
+				}
+			}
+		}
+		operations[i] = op
+	}
+	return operations
+}
+
+// diff compares the documents by field and returns the update with a copy of the object holding the changes
+func diff(fields modelFields, original, patched map[string]interface{}, object reflect.Value) (*Update, reflect.Value, error) {
+	update := &Update{Translations: map[string]map[string]interface{}{}}
+	target := reflect.New(object.Type()).Elem()
+	target.Set(object)
+
+	keys := map[string]bool{}
+	for key := range original {
+		keys[key] = true
+	}
+	for key := range patched {
+		keys[key] = true
+	}
+
+	for _, key := range sortedKeys(keys) {
+		before, after := original[key], patched[key]
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		f, ok := fields[key]
+		if !ok {
+			return nil, target, invalid(http.StatusUnprocessableEntity, "patch field", "patch.unknown_field", map[string]interface{}{"field": key})
+		}
+		if !f.updatable {
+			return nil, target, invalid(http.StatusUnprocessableEntity, "patch field", "patch.not_updatable", map[string]interface{}{"field": key})
+		}
+
+		field := target.FieldByIndex(f.index)
+		field.Set(reflect.Zero(field.Type()))
+		if after != nil {
+			data, _ := json.Marshal(after)
+			if err := json.Unmarshal(data, field.Addr().Interface()); err != nil {
+				return nil, target, invalid(http.StatusUnprocessableEntity, "patch field", "patch.invalid_value", map[string]interface{}{"field": key})
+			}
+		}
+
+		if languages, ok := changedLanguages(f, before, after); ok {
+			update.Translations[f.column] = languages
+			continue
+		}
+		update.Columns = append(update.Columns, f.column)
+	}
+	return update, target, nil
+}
+
+// changedLanguages returns the languages to update in a translation field, when a language
+// was removed the whole field has to be updated
+func changedLanguages(f modelField, before, after interface{}) (map[string]interface{}, bool) {
+	if !f.translation {
+		return nil, false
+	}
+	old, ok := before.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	current, ok := after.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	languages := map[string]interface{}{}
+	for code, text := range current {
+		if !reflect.DeepEqual(old[code], text) {
+			languages[code] = text
+		}
+	}
+	for code := range old {
+		if _, ok := current[code]; !ok {
+			return nil, false
+		}
+	}
+	return languages, true
+}
+
+// Update defines the columns changed by a patch, translation fields with only changed or
+// added languages are updated by their jsonb paths
+type Update struct {
+	Columns      []string
+	Translations map[string]map[string]interface{}
+	languageCode string
+}
+
+// Empty returns if the patch did not change any column
+func (u *Update) Empty() bool {
+	return len(u.Columns) == 0 && len(u.Translations) == 0
+}
+
+// Exec writes the changes of the object to the table rows matching the options
+func (u *Update) Exec(ctx context.Context, trs *db.Transaction, table string, object interface{}, opt *db.Options) error {
+	if len(u.Columns) > 0 {
+		translation.SetStructTranslationsLanguage(object, "all")
+		defer translation.SetStructTranslationsLanguage(object, u.languageCode)
+		err := tracing.SQL(ctx, "update", table, func() error {
+			return db.UpdateStructTx(trs.Tx, table, object, opt, strings.Join(u.Columns, ","))
+		})
+		if err != nil {
+			return customerror.New(http.StatusInternalServerError, "patch update", err.Error())
+		}
+	}
+
+	if len(u.Translations) > 0 {
+		statement := builder.Update(table)
+		for _, column := range sortedKeys(u.Translations) {
+			languages := u.Translations[column]
+			for _, code := range sortedKeys(languages) {
+				statement.JSON(column, code)
+				jsonVal, _ := json.Marshal(languages[code])
+				statement.Values(jsonVal)
+			}
+		}
+		statement.Where(opt.Conditions)
+		if err := tracing.SQL(ctx, "update", table, func() error {
+			_, err := trs.Query(statement)
+			return err
+		}); err != nil {
+			return customerror.New(http.StatusInternalServerError, "patch update translations", err.Error())
+		}
+	}
+	return nil
+}
+
+// modelField defines how a struct field can be patched
+type modelField struct {
+	index       []int
+	column      string
+	updatable   bool
+	translation bool
+}
+
+// modelFields maps the json name to the struct field
+type modelFields map[string]modelField
+
+// auditColumns are written by the patch and can not be changed by the client
+var auditColumns = map[string]bool{"created_by": true, "created_at": true, "updated_by": true, "updated_at": true}
+
+// protectedColumns can never be patched even when the field is not tagged updatable:"false", the
+// primary key and the credentials and security grants of a user must be changed by their own endpoints
+var protectedColumns = map[string]bool{"id": true, "password": true, "token": true, "security": true, "security_instances": true}
+
+// fieldsOf returns the fields of the struct including the embedded ones by their json names
+func fieldsOf(t reflect.Type) modelFields {
+	fields := modelFields{}
+	addFields(fields, t, nil)
+	return fields
+}
+
+func addFields(fields modelFields, t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addFields(fields, field.Type, fieldIndex)
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		column := field.Tag.Get("sql")
+		fields[name] = modelField{
+			index:       fieldIndex,
+			column:      column,
+			updatable:   column != "" && column != "-" && field.Tag.Get("updatable") != "false" && field.Tag.Get("pk") != "true" && !auditColumns[column] && !protectedColumns[column],
+			translation: field.Type == reflect.TypeOf(translation.Translation{}),
+		}
+	}
+}
+
+// byColumn returns the field of the sql column
+func (m modelFields) byColumn(column string) (modelField, bool) {
+	for _, f := range m {
+		if f.column == column {
+			return f, true
+		}
+	}
+	return modelField{}, false
+}
+
+// decode reads json keeping the numbers as json.Number so they are compared and written unchanged
+func decode(data []byte) (interface{}, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, invalid(http.StatusBadRequest, "patch decode", "patch.invalid_document", nil)
+	}
+	return doc, nil
+}
+
+// sortedKeys returns the map keys in order so the generated statements are stable
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,240 @@
+package patch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/models/customerror"
+	"github.com/agile-work/srv-mdl-shared/models/job"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"github.com/agile-work/srv-mdl-shared/models/user"
+)
+
+type model struct {
+	ID        string                  `json:"id" sql:"id" pk:"true"`
+	Code      string                  `json:"code" sql:"code" updatable:"false" validate:"required"`
+	Name      translation.Translation `json:"name" sql:"name" field:"jsonb" validate:"required,translation_default"`
+	Size      int                     `json:"size" sql:"size" validate:"max=10"`
+	Tags      []string                `json:"tags" sql:"tags" field:"jsonb"`
+	Secret    string                  `json:"-" sql:"secret"`
+	UpdatedBy string                  `json:"updated_by" sql:"updated_by"`
+	UpdatedAt time.Time               `json:"updated_at" sql:"updated_at"`
+}
+
+func newModel() *model {
+	return &model{ID: "1", Code: "a", Size: 1, Tags: []string{"x", "y"}, Secret: "s",
+		Name: translation.Translation{Language: map[string]string{"pt-br": "Nome", "en": "Name"}}}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		patch        string
+		language     string
+		columns      []string
+		translations map[string]map[string]interface{}
+		check        func(m *model) bool
+	}{
+		{
+			name:         "columns and translation in the language",
+			patch:        `{"name":"Title","size":5,"tags":null}`,
+			language:     "en",
+			columns:      []string{"size", "tags", "updated_by", "updated_at"},
+			translations: map[string]map[string]interface{}{"name": {"en": "Title"}},
+			check: func(m *model) bool {
+				return m.Size == 5 && m.Tags == nil && m.Name.Language["pt-br"] == "Nome" && m.Name.Language["en"] == "Title" && m.Name.RequestLanguageCode == "en"
+			},
+		},
+		{
+			name:         "translation without language uses the default",
+			patch:        `{"name":"Titulo"}`,
+			columns:      []string{"updated_by", "updated_at"},
+			translations: map[string]map[string]interface{}{"name": {"pt-br": "Titulo"}},
+			check:        func(m *model) bool { return m.Name.Language["pt-br"] == "Titulo" && m.Name.Language["en"] == "Name" },
+		},
+		{
+			name:         "removed language updates the whole column",
+			patch:        `{"name":{"en":null}}`,
+			columns:      []string{"name", "updated_by", "updated_at"},
+			translations: map[string]map[string]interface{}{},
+			check:        func(m *model) bool { return len(m.Name.Language) == 1 },
+		},
+		{
+			name:         "array replaced",
+			patch:        `{"tags":["z"]}`,
+			columns:      []string{"tags", "updated_by", "updated_at"},
+			translations: map[string]map[string]interface{}{},
+			check:        func(m *model) bool { return reflect.DeepEqual(m.Tags, []string{"z"}) },
+		},
+		{
+			name:         "unchanged values",
+			patch:        `{"size":1,"code":"a"}`,
+			translations: map[string]map[string]interface{}{},
+			check:        func(m *model) bool { return m.UpdatedBy == "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newModel()
+			p, err := NewMergePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := p.Language(tt.language).User("bob").Apply(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(u.Columns, tt.columns) || !reflect.DeepEqual(u.Translations, tt.translations) {
+				t.Fatalf("columns %v translations %v", u.Columns, u.Translations)
+			}
+			if !tt.check(m) || m.Secret != "s" {
+				t.Fatalf("%+v", m)
+			}
+			if len(tt.columns) > 0 && m.UpdatedBy != "bob" {
+				t.Fatalf("updated_by %s", m.UpdatedBy)
+			}
+		})
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	m := newModel()
+	req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`[
+		{"op":"test","path":"/size","value":1},
+		{"op":"replace","path":"/name","value":"Titulo"},
+		{"op":"add","path":"/tags/1","value":"z"},
+		{"op":"remove","path":"/tags/0"},
+		{"op":"copy","from":"/tags/0","path":"/tags/-"},
+		{"op":"move","from":"/tags/2","path":"/tags/0"},
+		{"op":"replace","path":"/tags/2","value":"w"},
+		{"op":"replace","path":"/size","value":3}
+	]`))
+	req.Header.Set("Content-Type", "application/json-patch+json; charset=utf-8")
+	req = req.WithContext(user.NewContext(req.Context(), user.NewPrincipal(&user.User{Username: "bob", LanguageCode: "pt-br"}, "")))
+	p, err := Parse(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := p.Apply(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m.Tags, []string{"z", "z", "w"}) || m.Size != 3 || m.Name.Language["pt-br"] != "Titulo" || m.UpdatedBy != "bob" {
+		t.Fatalf("%+v", m)
+	}
+	if !reflect.DeepEqual(u.Columns, []string{"size", "tags", "updated_by", "updated_at"}) || !reflect.DeepEqual(u.Translations, map[string]map[string]interface{}{"name": {"pt-br": "Titulo"}}) {
+		t.Fatal(u.Columns, u.Translations)
+	}
+}
+
+func TestParsePrincipal(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *user.Principal
+		language  string
+		want      string
+		username  string
+	}{
+		{name: "principal", principal: user.NewPrincipal(&user.User{Username: "bob", LanguageCode: "en"}, ""), language: "pt-br", want: "en", username: "bob"},
+		{name: "without principal", language: "en", want: "en"},
+		{name: "without principal and language", want: "pt-br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"name":"Title"}`))
+			req.Header.Set("Content-Language", tt.language)
+			req.Header.Set("Username", "spoofed")
+			if tt.principal != nil {
+				req = req.WithContext(user.NewContext(req.Context(), tt.principal))
+			}
+			p, err := Parse(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := newModel()
+			u, err := p.Apply(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := u.Translations["name"][tt.want]; !ok || m.UpdatedBy != tt.username {
+				t.Fatalf("translations %v updated_by %q", u.Translations, m.UpdatedBy)
+			}
+		})
+	}
+}
+
+func TestApplyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		status int
+	}{
+		{"not updatable", `{"code":"b"}`, http.StatusUnprocessableEntity},
+		{"primary key", `{"id":"2"}`, http.StatusUnprocessableEntity},
+		{"audit", `{"updated_by":"eve"}`, http.StatusUnprocessableEntity},
+		{"unknown field", `{"other":1}`, http.StatusUnprocessableEntity},
+		{"validation", `{"size":11}`, http.StatusBadRequest},
+		{"invalid value", `{"size":"a"}`, http.StatusUnprocessableEntity},
+		{"default language removed", `{"name":{"pt-br":null}}`, http.StatusBadRequest},
+		{"json patch test failed", `[{"op":"test","path":"/size","value":2}]`, http.StatusConflict},
+		{"json patch primary key", `[{"op":"replace","path":"/id","value":"2"}]`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newModel()
+			p, err := NewMergePatch([]byte(tt.patch))
+			if strings.HasPrefix(tt.patch, "[") {
+				p, err = NewJSONPatch([]byte(tt.patch))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.Apply(m)
+			if customerror.Status(err) != tt.status {
+				t.Fatalf("got %v, want status %d", err, tt.status)
+			}
+			want := newModel()
+			want.Name.RequestLanguageCode = m.Name.RequestLanguageCode
+			if !reflect.DeepEqual(m, want) {
+				t.Fatalf("object changed %+v", m)
+			}
+		})
+	}
+	if _, err := NewMergePatch([]byte(`[1]`)); customerror.Status(err) != http.StatusBadRequest {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyProtectedColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		object interface{}
+		patch  string
+	}{
+		{"job id", &job.Job{ID: "1"}, `{"id":"2"}`},
+		{"task id", &job.Task{ID: "1"}, `{"id":"2"}`},
+		{"job instance id", &job.Instance{ID: "1"}, `{"id":"2"}`},
+		{"instance task id", &job.InstanceTask{ID: "1"}, `{"id":"2"}`},
+		{"user id", &user.User{ID: "1"}, `{"id":"2"}`},
+		{"user security", &user.User{ID: "1"}, `{"security":{"schema":{"contracts":{"edit":{"total":true}}}}}`},
+		{"user security instances", &user.User{ID: "1"}, `{"security_instances":{"schema":{}}}`},
+		{"user token", &user.User{ID: "1"}, `{"token":"t"}`},
+		{"user password", &user.User{ID: "1"}, `{"password":"p"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewMergePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := p.Apply(tt.object); !errors.Is(err, customerror.ErrValidation) || customerror.Status(err) != http.StatusUnprocessableEntity {
+				t.Fatalf("got %v, want the write rejected", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/agile-work/srv-shared/socket"
+)
+
+// ErrUnavailable returned when the socket is not connected before the deadline
+var ErrUnavailable = errors.New("realtime socket unavailable")
+
+// Client keeps the socket connection state notifying the subscribers when it changes
+// and keeps the outbound messages queued until the socket is connected
+type Client struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	available   func() bool
+	emit        func(socket.Message) error
+	mutex       sync.Mutex
+	connected   bool
+	subscribers map[chan bool]bool
+	queue       []*pending
+	wake        chan struct{}
+}
+
+// pending defines a queued message waiting for the connection
+type pending struct {
+	message socket.Message
+	result  chan error
+}
+
+// New returns a client over the socket package connection, the package has no connection
+// callbacks so the client checks socket.Available with backoff
+func New() *Client {
+	return NewClient(socket.Available, socket.Emit)
+}
+
+// NewClient returns a client over any connection, used when the socket is injected in the server,
+// connections with connect and disconnect callbacks should pass a nil available and call SetConnected
+func NewClient(available func() bool, emit func(socket.Message) error) *Client {
+	return &Client{
+		MinBackoff:  100 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+		available:   available,
+		emit:        emit,
+		subscribers: map[chan bool]bool{},
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Run sends the queued messages when the socket is connected and runs until the context is done,
+// it waits for SetConnected and, when the client has an available function, checks it with backoff
+// while disconnected and every MaxBackoff while connected
+func (c *Client) Run(ctx context.Context) {
+	backoff := c.MinBackoff
+	for {
+		if c.available != nil {
+			c.setConnected(c.available())
+		}
+
+		var check <-chan time.Time
+		if c.Available() {
+			c.flush()
+			backoff = c.MinBackoff
+			if c.available != nil {
+				check = time.After(c.MaxBackoff)
+			}
+		} else if c.available != nil {
+			check = time.After(backoff)
+			backoff *= 2
+			if backoff > c.MaxBackoff {
+				backoff = c.MaxBackoff
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			c.setConnected(false)
+			return
+		case <-c.wake:
+		case <-check:
+		}
+	}
+}
+
+// SetConnected changes the connection state, it should be called by the socket connect
+// and disconnect callbacks so the queued messages are sent as soon as it connects
+func (c *Client) SetConnected(connected bool) {
+	c.setConnected(connected)
+	c.notify()
+}
+
+// Available returns the last known connection state
+func (c *Client) Available() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.connected
+}
+
+// Subscribe returns a channel receiving the connection state on every change,
+// the returned function must be called to stop receiving
+func (c *Client) Subscribe() (<-chan bool, func()) {
+	ch := make(chan bool, 1)
+	c.mutex.Lock()
+	c.subscribers[ch] = true
+	c.mutex.Unlock()
+
+	return ch, func() {
+		c.mutex.Lock()
+		delete(c.subscribers, ch)
+		c.mutex.Unlock()
+	}
+}
+
+// WaitAvailable blocks until the socket is connected or returns ErrUnavailable when the context is done
+func (c *Client) WaitAvailable(ctx context.Context) error {
+	changes, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	if c.Available() {
+		return nil
+	}
+	c.notify()
+	for {
+		select {
+		case connected := <-changes:
+			if connected {
+				return nil
+			}
+		case <-ctx.Done():
+			return ErrUnavailable
+		}
+	}
+}
+
+// Emit queues the message and blocks until it is sent and returns the send result, if the socket is
+// not connected before the context is done the message is discarded and ErrUnavailable is returned
+func (c *Client) Emit(ctx context.Context, message socket.Message) error {
+	p := &pending{message: message, result: make(chan error, 1)}
+	c.mutex.Lock()
+	c.queue = append(c.queue, p)
+	c.mutex.Unlock()
+	c.notify()
+
+	select {
+	case err := <-p.result:
+		return err
+	case <-ctx.Done():
+		if c.discard(p) {
+			return ErrUnavailable
+		}
+		// the message is being sent, its result is returned instead of the deadline
+		return <-p.result
+	}
+}
+
+// setConnected updates the connection state notifying the subscribers when it changes
+func (c *Client) setConnected(connected bool) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.connected != connected {
+		c.connected = connected
+		for ch := range c.subscribers {
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- connected
+		}
+	}
+	return connected
+}
+
+// flush sends the queued messages in order, a failure is returned to the sender of the
+// message and the client waits to be connected again before sending the next ones
+func (c *Client) flush() {
+	for {
+		c.mutex.Lock()
+		if len(c.queue) == 0 || !c.connected {
+			c.mutex.Unlock()
+			return
+		}
+		p := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mutex.Unlock()
+
+		err := c.emit(p.message)
+		p.result <- err
+		if err != nil {
+			c.setConnected(false)
+			return
+		}
+	}
+}
+
+// discard removes the message from the queue and returns false if it was already removed
+func (c *Client) discard(p *pending) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, queued := range c.queue {
+		if queued == p {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// notify wakes up the run loop to check the connection
+func (c *Client) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Default client used by the package functions
+var Default = New()
+
+// Run watches the default client connection
+func Run(ctx context.Context) {
+	Default.Run(ctx)
+}
+
+// Available returns the default client connection state
+func Available() bool {
+	return Default.Available()
+}
+
+// WaitAvailable blocks until the default client is connected
+func WaitAvailable(ctx context.Context) error {
+	return Default.WaitAvailable(ctx)
+}
+
+// Emit sends the message with the default client
+func Emit(ctx context.Context, message socket.Message) error {
+	return Default.Emit(ctx, message)
+}
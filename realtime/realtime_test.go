@@ -0,0 +1,131 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agile-work/srv-shared/socket"
+)
+
+// testClient returns a running client counting the sent messages, emitErr fails every send
+func testClient(t *testing.T, available func() bool, emitErr error) (*Client, *int32) {
+	sent := new(int32)
+	c := NewClient(available, func(socket.Message) error {
+		if emitErr != nil {
+			return emitErr
+		}
+		atomic.AddInt32(sent, 1)
+		return nil
+	})
+	c.MinBackoff = time.Millisecond
+	c.MaxBackoff = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go c.Run(ctx)
+	return c, sent
+}
+
+func TestEmit(t *testing.T) {
+	failed := errors.New("write failed")
+	tests := []struct {
+		name    string
+		connect bool
+		emitErr error
+		want    error
+		sent    int32
+	}{
+		{name: "connected", connect: true, sent: 1},
+		{name: "never connected", want: ErrUnavailable},
+		{name: "send failure", connect: true, emitErr: failed, want: failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, sent := testClient(t, nil, tt.emitErr)
+			if tt.connect {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					c.SetConnected(true)
+				}()
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			if err := c.Emit(ctx, socket.Message{}); err != tt.want {
+				t.Fatalf("Emit = %v, want %v", err, tt.want)
+			}
+			if got := atomic.LoadInt32(sent); got != tt.sent {
+				t.Errorf("sent = %d, want %d", got, tt.sent)
+			}
+			if tt.emitErr != nil && c.Available() {
+				t.Error("still connected after a send failure")
+			}
+		})
+	}
+}
+
+func TestEmitQueued(t *testing.T) {
+	c, sent := testClient(t, nil, nil)
+
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Emit(short, socket.Message{}); err != ErrUnavailable {
+		t.Fatalf("Emit = %v, want ErrUnavailable", err)
+	}
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() { results <- c.Emit(context.Background(), socket.Message{}) }()
+	}
+	time.Sleep(10 * time.Millisecond)
+	c.SetConnected(true)
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := atomic.LoadInt32(sent); got != 3 {
+		t.Errorf("sent = %d, the discarded message should not be sent", got)
+	}
+}
+
+func TestAvailableBackoff(t *testing.T) {
+	var up int32
+	c, sent := testClient(t, func() bool { return atomic.LoadInt32(&up) == 1 }, nil)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&up, 1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.WaitAvailable(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Emit(ctx, socket.Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(sent); got != 1 {
+		t.Errorf("sent = %d", got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c, _ := testClient(t, nil, nil)
+	changes, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	for _, connected := range []bool{true, false, true} {
+		c.SetConnected(connected)
+		select {
+		case got := <-changes:
+			if got != connected {
+				t.Fatalf("change = %v, want %v", got, connected)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("change not notified")
+		}
+	}
+}
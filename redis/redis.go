@@ -0,0 +1,286 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNil returned when the key does not exist
+var ErrNil = errors.New("redis: nil")
+
+// Error defines an error reply of the server
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Client sends the commands that need an atomic reply, like SET NX, EVAL and the lists,
+// the rdb package keeps the plain get, set and delete
+type Client struct {
+	addr     string
+	password string
+	timeout  time.Duration
+	idle     chan *conn
+}
+
+// conn defines an open connection and its reader
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+var (
+	defaultMutex  sync.RWMutex
+	defaultClient *Client
+)
+
+// NewClient returns a client for the server address, connections are opened on demand
+// and up to size idle ones are kept
+func NewClient(host string, port int, password string, size int) *Client {
+	return &Client{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		password: password,
+		timeout:  5 * time.Second,
+		idle:     make(chan *conn, size),
+	}
+}
+
+// Init defines the package client, the previous one is closed after the swap
+// so the commands in flight finish on it
+func Init(host string, port int, password string) {
+	defaultMutex.Lock()
+	previous := defaultClient
+	defaultClient = NewClient(host, port, password, 10)
+	defaultMutex.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+// Close closes the package client
+func Close() {
+	defaultMutex.Lock()
+	previous := defaultClient
+	defaultClient = nil
+	defaultMutex.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+// Do sends a command with the package client
+func Do(args ...interface{}) (interface{}, error) {
+	defaultMutex.RLock()
+	c := defaultClient
+	defaultMutex.RUnlock()
+	if c == nil {
+		return nil, errors.New("redis: client not initialized")
+	}
+	return c.Do(args...)
+}
+
+// Close closes the idle connections
+func (c *Client) Close() {
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Do sends the command and returns the reply as string, int64, []interface{} or nil,
+// error replies are returned as Error and the connection is kept
+func (c *Client) Do(args ...interface{}) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(c.timeout, args...)
+	if _, ok := err.(Error); err != nil && !ok {
+		cn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+	return reply, err
+}
+
+// get returns an idle connection or opens a new one
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	nc, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, reader: bufio.NewReader(nc)}
+	if c.password != "" {
+		if _, err := cn.do(c.timeout, "AUTH", c.password); err != nil {
+			cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// do writes the command as a RESP array of bulk strings and reads the reply
+func (cn *conn) do(timeout time.Duration, args ...interface{}) (interface{}, error) {
+	cn.SetDeadline(time.Now().Add(timeout))
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		var value string
+		switch v := arg.(type) {
+		case string:
+			value = v
+		case []byte:
+			value = string(v)
+		case int:
+			value = strconv.Itoa(v)
+		case int64:
+			value = strconv.FormatInt(v, 10)
+		case time.Duration:
+			value = strconv.FormatInt(int64(v/time.Millisecond), 10)
+		default:
+			value = fmt.Sprint(v)
+		}
+		buf = append(buf, "$"+strconv.Itoa(len(value))+"\r\n"+value+"\r\n"...)
+	}
+	if _, err := cn.Write(buf); err != nil {
+		return nil, err
+	}
+	return readReply(cn.reader)
+}
+
+// readReply reads a RESP reply
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, Error(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(line)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				if _, ok := err.(Error); !ok {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: invalid reply %q", string(kind)+line)
+}
+
+// Get returns the key value or ErrNil when it does not exist
+func Get(key string) (string, error) {
+	reply, err := Do("GET", key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", ErrNil
+	}
+	return value, nil
+}
+
+// SetNX sets the key with the expiration only when it does not exist
+func SetNX(key, value string, expiration time.Duration) (bool, error) {
+	reply, err := Do("SET", key, value, "PX", expiration, "NX")
+	return reply != nil, err
+}
+
+// Eval runs the lua script atomically with the keys and the args
+func Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	cmd := []interface{}{"EVAL", script, len(keys)}
+	for _, key := range keys {
+		cmd = append(cmd, key)
+	}
+	return Do(append(cmd, args...)...)
+}
+
+// LPush adds the values to the head of the list and returns its length
+func LPush(key string, values ...string) (int64, error) {
+	cmd := []interface{}{"LPUSH", key}
+	for _, value := range values {
+		cmd = append(cmd, value)
+	}
+	return integer(Do(cmd...))
+}
+
+// LRem removes count occurrences of the value from the list, zero removes all of them
+func LRem(key string, count int64, value string) (int64, error) {
+	return integer(Do("LREM", key, count, value))
+}
+
+// LRange returns the list items between start and stop, -1 is the last item
+func LRange(key string, start, stop int64) ([]string, error) {
+	reply, err := Do("LRANGE", key, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	items := []string{}
+	for _, item := range list {
+		if value, ok := item.(string); ok {
+			items = append(items, value)
+		}
+	}
+	return items, nil
+}
+
+// integer returns an integer reply
+func integer(reply interface{}, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	i, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return i, nil
+}
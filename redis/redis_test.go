@@ -0,0 +1,132 @@
+package redis
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers each command with the reply defined by its name and records the commands
+func fakeServer(t *testing.T, replies map[string]string) (string, int, chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	commands := make(chan []string, 16)
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				r := bufio.NewReader(nc)
+				for {
+					reply, err := readReply(r)
+					if err != nil {
+						return
+					}
+					args := []string{}
+					for _, arg := range reply.([]interface{}) {
+						args = append(args, arg.(string))
+					}
+					commands <- args
+					nc.Write([]byte(replies[args[0]]))
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, commands
+}
+
+func TestDo(t *testing.T) {
+	host, port, commands := fakeServer(t, map[string]string{
+		"AUTH":   "+OK\r\n",
+		"PING":   "+PONG\r\n",
+		"INCR":   ":3\r\n",
+		"GET":    "$5\r\nhello\r\n",
+		"MISS":   "$-1\r\n",
+		"LRANGE": "*3\r\n$1\r\na\r\n$-1\r\n:2\r\n",
+		"BAD":    "-ERR unknown command\r\n",
+	})
+	c := NewClient(host, port, "secret", 1)
+	defer c.Close()
+
+	tests := []struct {
+		args    []interface{}
+		want    interface{}
+		wantErr string
+		sent    []string
+	}{
+		{args: []interface{}{"PING"}, want: "PONG", sent: []string{"PING"}},
+		{args: []interface{}{"INCR", "count"}, want: int64(3), sent: []string{"INCR", "count"}},
+		{args: []interface{}{"GET", "key"}, want: "hello", sent: []string{"GET", "key"}},
+		{args: []interface{}{"MISS"}, want: nil, sent: []string{"MISS"}},
+		{args: []interface{}{"LRANGE", "list", int64(0), -1}, want: []interface{}{"a", nil, int64(2)}, sent: []string{"LRANGE", "list", "0", "-1"}},
+		{args: []interface{}{"BAD", 1500 * time.Millisecond}, wantErr: "ERR unknown command", sent: []string{"BAD", "1500"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.sent[0], func(t *testing.T) {
+			got, err := c.Do(tt.args...)
+			if tt.wantErr != "" {
+				if _, ok := err.(Error); !ok || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("reply = %#v %v, want %#v", got, err, tt.want)
+			}
+			if i == 0 {
+				if auth := <-commands; strings.Join(auth, " ") != "AUTH secret" {
+					t.Fatalf("first command = %v, want AUTH", auth)
+				}
+			}
+			if sent := <-commands; !reflect.DeepEqual(sent, tt.sent) {
+				t.Errorf("sent = %v, want %v", sent, tt.sent)
+			}
+		})
+	}
+	select {
+	case cmd := <-commands:
+		t.Errorf("connection not reused, sent %v", cmd)
+	default:
+	}
+}
+
+func TestPackageClient(t *testing.T) {
+	host, port, commands := fakeServer(t, map[string]string{
+		"GET":  "$-1\r\n",
+		"SET":  "$-1\r\n",
+		"EVAL": "*2\r\n:1\r\n:2\r\n",
+	})
+	Close()
+	if _, err := Do("PING"); err == nil {
+		t.Fatal("closed client sent the command")
+	}
+	Init(host, port, "")
+	defer Close()
+
+	if _, err := Get("missing"); err != ErrNil {
+		t.Errorf("get error = %v, want ErrNil", err)
+	}
+	<-commands
+	if ok, err := SetNX("key", "value", time.Minute); ok || err != nil {
+		t.Errorf("setnx = %v %v, want false", ok, err)
+	}
+	if sent := <-commands; strings.Join(sent, " ") != "SET key value PX 60000 NX" {
+		t.Errorf("setnx sent %v", sent)
+	}
+	reply, err := Eval("return 1", []string{"a", "b"}, 10)
+	if err != nil || !reflect.DeepEqual(reply, []interface{}{int64(1), int64(2)}) {
+		t.Errorf("eval = %v %v", reply, err)
+	}
+	if sent := <-commands; strings.Join(sent, " ") != "EVAL return 1 2 a b 10" {
+		t.Errorf("eval sent %v", sent)
+	}
+}
@@ -0,0 +1,304 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/metrics"
+	"github.com/agile-work/srv-mdl-shared/realtime"
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/agile-work/srv-shared/rdb"
+	"github.com/agile-work/srv-shared/service"
+	"github.com/agile-work/srv-shared/socket"
+)
+
+const (
+	// ModulesKey redis list with the instance code of every registered module
+	ModulesKey = "api:modules"
+	// DefinitionKeyPrefix redis key prefix with the module definition used by the api gateway
+	DefinitionKeyPrefix = "module:def:"
+	// InstanceKeyPrefix redis key prefix with the instance entry
+	InstanceKeyPrefix = "module:instance:"
+)
+
+// DefaultTTL time an instance is kept registered without a heartbeat
+const DefaultTTL = 30 * time.Second
+
+// reloadTimeout time Run waits for the socket to send a reload message
+const reloadTimeout = 15 * time.Second
+
+// Entry defines a module instance registered in redis
+type Entry struct {
+	Code         string    `json:"code"`
+	InstanceCode string    `json:"instance_code"`
+	Name         string    `json:"name"`
+	URL          string    `json:"url"`
+	Port         int       `json:"port"`
+	PID          int       `json:"pid"`
+	RegisteredAt time.Time `json:"registered_at"`
+	HeartbeatAt  time.Time `json:"heartbeat_at"`
+}
+
+// Registry keeps a module instance registered while the process is alive
+type Registry struct {
+	module     *service.Module
+	realtime   *realtime.Client
+	entry      Entry
+	ttl        time.Duration
+	mutex      sync.Mutex
+	registered bool
+}
+
+// New returns the registry for a module instance, ttl defines how long the instance is
+// kept without a heartbeat, heartbeats are sent on every third of the ttl, the reload messages
+// are sent with the client and a nil client uses realtime.Default
+func New(code string, module *service.Module, ttl time.Duration, client *realtime.Client) *Registry {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if client == nil {
+		client = realtime.Default
+	}
+	return &Registry{
+		module:   module,
+		realtime: client,
+		ttl:      ttl,
+		entry: Entry{
+			Code:         code,
+			InstanceCode: module.InstanceCode,
+			Name:         module.Name,
+			URL:          module.URL(),
+			Port:         module.Port,
+			PID:          module.PID,
+		},
+	}
+}
+
+// Register writes the definition and entry expiring after the ttl and then adds the instance
+// to the modules list, so Sweep never finds it in the list without a definition
+func (r *Registry) Register() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.entry.RegisteredAt = time.Now()
+	if err := r.refresh(); err != nil {
+		return err
+	}
+	if _, err := redis.LRem(ModulesKey, 0, r.entry.InstanceCode); err != nil {
+		return err
+	}
+	if _, err := redis.LPush(ModulesKey, r.entry.InstanceCode); err != nil {
+		return err
+	}
+	r.registered = true
+	return nil
+}
+
+// Deregister removes the instance from the modules list
+func (r *Registry) Deregister() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.registered = false
+	return remove(r.entry.InstanceCode)
+}
+
+// Heartbeat renews the instance ttl if it is registered and adds it back to the modules list
+// when it is not there, like after being swept while redis was not reachable
+func (r *Registry) Heartbeat() error {
+	_, err := r.heartbeat()
+	return err
+}
+
+// heartbeat returns true when the instance was added back to the modules list
+func (r *Registry) heartbeat() (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.registered {
+		return false, nil
+	}
+	if err := r.refresh(); err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	instances, err := redis.LRange(ModulesKey, 0, -1)
+	metrics.ObserveRedis("lrange", start, err)
+	if err != nil {
+		return false, err
+	}
+	for _, instanceCode := range instances {
+		if instanceCode == r.entry.InstanceCode {
+			return false, nil
+		}
+	}
+	if _, err := redis.LPush(ModulesKey, r.entry.InstanceCode); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Run sends the heartbeats and sweeps the stale instances until the context is done, the reload
+// messages are sent in their own goroutine so a disconnected socket does not delay the heartbeats
+func (r *Registry) Run(ctx context.Context) {
+	heartbeat := time.NewTicker(r.ttl / 3)
+	defer heartbeat.Stop()
+	stale := time.NewTicker(r.ttl)
+	defer stale.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			added, err := r.heartbeat()
+			if err != nil {
+				logger.Log.WithField("instance", r.entry.InstanceCode).Errorf("registry heartbeat: %s", err.Error())
+			}
+			if added {
+				logger.Log.WithField("instance", r.entry.InstanceCode).Warn("registry instance added back to the modules list")
+				go r.reload(ctx)
+			}
+		case <-stale.C:
+			removed, err := removeStale()
+			if err != nil {
+				logger.Log.Errorf("registry sweep: %s", err.Error())
+			}
+			if removed > 0 {
+				go r.reload(ctx)
+			}
+		}
+	}
+}
+
+// reload emits the reload message waiting at most the reloadTimeout for the socket
+func (r *Registry) reload(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, reloadTimeout)
+	defer cancel()
+	if err := r.EmitReload(ctx); err != nil {
+		logger.Log.Errorf("registry reload: %s", err.Error())
+	}
+}
+
+// refresh writes the definition and the entry with the ttl
+func (r *Registry) refresh() error {
+	r.entry.HeartbeatAt = time.Now()
+	entryJSON, err := json.Marshal(r.entry)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = rdb.Set(DefinitionKeyPrefix+r.entry.InstanceCode, r.module.JSON(), r.ttl)
+	metrics.ObserveRedis("set", start, err)
+	if err != nil {
+		return err
+	}
+	start = time.Now()
+	err = rdb.Set(InstanceKeyPrefix+r.entry.InstanceCode, string(entryJSON), r.ttl)
+	metrics.ObserveRedis("set", start, err)
+	return err
+}
+
+// EmitReload notifies the api that the modules list changed with the registry client
+func (r *Registry) EmitReload(ctx context.Context) error {
+	return emitReload(ctx, r.realtime)
+}
+
+// Sweep removes from the modules list the instances without a definition, which means
+// the heartbeat stopped, and emits the reload message to the api when any was removed
+func Sweep(ctx context.Context) (int, error) {
+	removed, err := removeStale()
+	if removed > 0 {
+		if err := emitReload(ctx, realtime.Default); err != nil {
+			return removed, err
+		}
+	}
+	return removed, err
+}
+
+// removeStale removes the instances without a definition, a definition that can not be
+// read stops the sweep so the instances are not removed while redis is failing
+func removeStale() (int, error) {
+	start := time.Now()
+	instances, err := redis.LRange(ModulesKey, 0, -1)
+	metrics.ObserveRedis("lrange", start, err)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, instanceCode := range instances {
+		_, err := redis.Get(DefinitionKeyPrefix + instanceCode)
+		if err == nil {
+			continue
+		}
+		if err != redis.ErrNil {
+			return removed, err
+		}
+		if err := remove(instanceCode); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Instances returns the live instances of a module code, an empty code returns all of them
+func Instances(code string) ([]Entry, error) {
+	start := time.Now()
+	instances, err := redis.LRange(ModulesKey, 0, -1)
+	metrics.ObserveRedis("lrange", start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []Entry{}
+	for _, instanceCode := range instances {
+		entryJSON, err := redis.Get(InstanceKeyPrefix + instanceCode)
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry := Entry{}
+		if err := json.Unmarshal([]byte(entryJSON), &entry); err != nil {
+			return nil, err
+		}
+		if code == "" || entry.Code == code {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// EmitReload notifies the api that the modules list changed, the message waits
+// in the realtime queue until the socket is connected or the context is done
+func EmitReload(ctx context.Context) error {
+	return emitReload(ctx, realtime.Default)
+}
+
+func emitReload(ctx context.Context, client *realtime.Client) error {
+	return client.Emit(ctx, socket.Message{
+		Recipients: []string{"service.api"},
+		Data:       "reload",
+	})
+}
+
+// remove deletes the instance keys and removes it from the modules list
+func remove(instanceCode string) error {
+	if err := rdb.Delete(DefinitionKeyPrefix + instanceCode); err != nil {
+		return err
+	}
+	if err := rdb.Delete(InstanceKeyPrefix + instanceCode); err != nil {
+		return err
+	}
+	if _, err := redis.LRem(ModulesKey, 0, instanceCode); err != nil {
+		return err
+	}
+	return nil
+}
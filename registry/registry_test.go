@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/agile-work/srv-shared/service"
+)
+
+// fakeRedis keeps the strings and the modules list answering the commands used by the registry,
+// the keys in fail answer an error reply
+type fakeRedis struct {
+	mutex   sync.Mutex
+	values  map[string]string
+	modules []string
+	fail    map[string]bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{values: map[string]string{}, fail: map[string]bool{}}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(nc)
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	redis.Init(addr.IP.String(), addr.Port, "")
+	t.Cleanup(func() {
+		redis.Close()
+		ln.Close()
+	})
+	return f
+}
+
+func (f *fakeRedis) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := []string{}
+		for i := 0; i < n; i++ {
+			size, _ := r.ReadString('\n')
+			length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+			arg := make([]byte, length+2)
+			io.ReadFull(r, arg)
+			args = append(args, string(arg[:length]))
+		}
+		nc.Write([]byte(f.reply(args)))
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(args) > 1 && f.fail[args[1]] {
+		return "-ERR connection lost\r\n"
+	}
+	switch args[0] {
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "LRANGE":
+		reply := fmt.Sprintf("*%d\r\n", len(f.modules))
+		for _, item := range f.modules {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(item), item)
+		}
+		return reply
+	case "LPUSH":
+		f.modules = append([]string{args[2]}, f.modules...)
+		return fmt.Sprintf(":%d\r\n", len(f.modules))
+	case "LREM":
+		kept := []string{}
+		for _, item := range f.modules {
+			if item != args[3] {
+				kept = append(kept, item)
+			}
+		}
+		removed := len(f.modules) - len(kept)
+		f.modules = kept
+		return fmt.Sprintf(":%d\r\n", removed)
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (f *fakeRedis) list() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return strings.Join(f.modules, ",")
+}
+
+func TestRemoveStale(t *testing.T) {
+	tests := []struct {
+		name        string
+		modules     []string
+		definitions []string
+		fail        []string
+		removed     int
+		wantErr     bool
+		want        string
+	}{
+		{name: "all alive", modules: []string{"a", "b"}, definitions: []string{"a", "b"}, want: "a,b"},
+		{name: "stale instance", modules: []string{"a", "b", "c"}, definitions: []string{"a", "c"}, removed: 1, want: "a,c"},
+		{name: "read error keeps the instances", modules: []string{"a", "b"}, fail: []string{DefinitionKeyPrefix + "a"}, wantErr: true, want: "a,b"},
+		{name: "read error stops the sweep", modules: []string{"a", "b", "c"}, fail: []string{DefinitionKeyPrefix + "b"}, removed: 1, wantErr: true, want: "b,c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeRedis(t)
+			f.modules = tt.modules
+			for _, code := range tt.definitions {
+				f.values[DefinitionKeyPrefix+code] = "{}"
+			}
+			for _, key := range tt.fail {
+				f.fail[key] = true
+			}
+
+			removed, err := removeStale()
+			if (err != nil) != tt.wantErr || removed != tt.removed {
+				t.Errorf("removeStale = %d %v, want %d", removed, err, tt.removed)
+			}
+			if got := f.list(); got != tt.want {
+				t.Errorf("modules = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name       string
+		registered bool
+		modules    []string
+		added      bool
+		want       string
+	}{
+		{name: "listed", registered: true, modules: []string{"other", "core-1"}, want: "other,core-1"},
+		{name: "swept", registered: true, modules: []string{"other"}, added: true, want: "core-1,other"},
+		{name: "not registered", modules: []string{"other"}, want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeRedis(t)
+			f.modules = tt.modules
+			r := New("core", &service.Module{Name: "core", InstanceCode: "core-1"}, 0, nil)
+			r.registered = tt.registered
+
+			added, err := r.heartbeat()
+			if err != nil || added != tt.added {
+				t.Errorf("heartbeat = %v %v, want %v", added, err, tt.added)
+			}
+			if got := f.list(); got != tt.want {
+				t.Errorf("modules = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Secret names resolved by the module when starting or reloading
+const (
+	SecretDatabasePassword = "db_password"
+	SecretRedisPassword    = "redis_password"
+	SecretTLSKey           = "tls_key"
+)
+
+// ErrSecretNotFound returned by a provider when the secret is not defined
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider defines how to get a secret value by name
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// NewSecretProvider returns the provider defined in the config
+func NewSecretProvider(cfg SecretsConfig) (SecretProvider, error) {
+	switch cfg.Provider {
+	case "", "env":
+		return &EnvSecretProvider{Prefix: configEnvPrefix + "SECRET_"}, nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, errors.New("secrets file provider without directory")
+		}
+		return &FileSecretProvider{Dir: cfg.Dir}, nil
+	case "exec":
+		args := strings.Fields(cfg.Command)
+		if len(args) == 0 {
+			return nil, errors.New("secrets exec provider without command")
+		}
+		return &ExecSecretProvider{Command: args[0], Args: args[1:], Timeout: 10 * time.Second}, nil
+	}
+	return nil, fmt.Errorf("invalid secrets provider %s", cfg.Provider)
+}
+
+// EnvSecretProvider reads secrets from environment variables, db_password is read from <Prefix>DB_PASSWORD
+type EnvSecretProvider struct {
+	Prefix string
+}
+
+// Secret returns the environment variable value for the secret
+func (p *EnvSecretProvider) Secret(name string) (string, error) {
+	val, ok := os.LookupEnv(p.Prefix + strings.ToUpper(name))
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return val, nil
+}
+
+// FileSecretProvider reads each secret from a file with the secret name inside Dir
+type FileSecretProvider struct {
+	Dir string
+}
+
+// Secret returns the file content for the secret without the trailing line break
+func (p *FileSecretProvider) Secret(name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("secret %s: %s", name, err.Error())
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// ExecSecretProvider runs a helper command with the secret name as the last argument
+// and uses its output as the secret value, an empty output means the secret is not defined
+type ExecSecretProvider struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+// Secret returns the helper command output for the secret
+func (p *ExecSecretProvider) Secret(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, p.Command, append(p.Args, name)...)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %s %s", name, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	val := strings.TrimRight(string(out), "\r\n")
+	if val == "" {
+		return "", ErrSecretNotFound
+	}
+	return val, nil
+}
+
+// ResolveSecrets loads the passwords and the tls key using the provider
+func (c *Config) ResolveSecrets(provider SecretProvider) error {
+	dbPassword, err := optionalSecret(provider, SecretDatabasePassword)
+	if err != nil {
+		return err
+	}
+	redisPassword, err := optionalSecret(provider, SecretRedisPassword)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := c.TLS.resolveKey(provider)
+	if err != nil {
+		return err
+	}
+
+	c.Database.Password = dbPassword
+	c.Redis.Password = redisPassword
+	c.TLS.KeyPEM = keyPEM
+	return nil
+}
+
+// resolveKey returns the tls_key secret or the Key file content, plaintext listeners do not need a key
+func (c TLSConfig) resolveKey(provider SecretProvider) ([]byte, error) {
+	if c.Mode == TLSModePlaintext {
+		return nil, nil
+	}
+
+	tlsKey, err := optionalSecret(provider, SecretTLSKey)
+	if err != nil {
+		return nil, err
+	}
+	if tlsKey != "" {
+		return []byte(tlsKey), nil
+	}
+
+	keyPEM, err := ioutil.ReadFile(c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %s", SecretTLSKey, err.Error())
+	}
+	return keyPEM, nil
+}
+
+// optionalSecret returns an empty value when the secret is not defined
+func optionalSecret(provider SecretProvider, name string) (string, error) {
+	val, err := provider.Secret(name)
+	if err == ErrSecretNotFound {
+		return "", nil
+	}
+	return val, err
+}
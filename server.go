@@ -2,73 +2,54 @@ package shared
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
-	"flag"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"strings"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/agile-work/srv-mdl-shared/logger"
+	"github.com/agile-work/srv-mdl-shared/metrics"
 	"github.com/agile-work/srv-mdl-shared/models/translation"
-	"github.com/agile-work/srv-shared/rdb"
+	"github.com/agile-work/srv-mdl-shared/realtime"
+	"github.com/agile-work/srv-mdl-shared/registry"
+	"github.com/agile-work/srv-mdl-shared/tracing"
 	"github.com/agile-work/srv-shared/service"
-	"github.com/agile-work/srv-shared/socket"
 	"github.com/agile-work/srv-shared/util"
 
 	"github.com/agile-work/srv-shared/constants"
 
-	"gopkg.in/go-playground/validator.v9"
-
 	"github.com/agile-work/srv-shared/sql-builder/db"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
-var (
-	cert       = flag.String("cert", "cert.pem", "Path to certification")
-	key        = flag.String("key", "key.pem", "Path to certification key")
-	mdlHost    = flag.String("host", "", "Module host")
-	mdlPort    = flag.Int("port", -1, "Module port")
-	dbHost     = flag.String("dbHost", "cryo.cdnm8viilrat.us-east-2.rds-preview.amazonaws.com", "Database host")
-	dbPort     = flag.Int("dbPort", 5432, "Database port")
-	dbUser     = flag.String("dbUser", "cryoadmin", "Database user")
-	dbPassword = flag.String("dbPassword", "x3FhcrWDxnxCq9p", "Database password")
-	dbName     = flag.String("dbName", "cryo", "Database name")
-	redisHost  = flag.String("redisHost", "localhost", "Redis host")
-	redisPort  = flag.Int("redisPort", 6379, "Redis port")
-	redisPass  = flag.String("redisPass", "redis123", "Redis password")
-	wsHost     = flag.String("wsHost", "localhost", "Realtime host")
-	wsPort     = flag.Int("wsPort", 8010, "Realtime port")
-	store      = flag.Bool("store", false, "Persiste this instance to the database")
-	install    = flag.Bool("install", false, "Install this module to the system")
-)
-
-// Validate global instance of the validator
-var Validate *validator.Validate
-
 // InstallModule function to define how to install the module
 type InstallModule func(moduleID string) error
 
 // registerModule execute module installation job
-func registerModule(code, host string, port int, installModule InstallModule) {
-	fmt.Printf("Installing Module %s...\n", code)
+func registerModule(cfg *Config, installModule InstallModule) {
+	log := logger.Log.WithField("module", cfg.Module.Code)
+	log.Info("installing module")
 
-	err := db.Connect(*dbHost, *dbPort, *dbUser, *dbPassword, *dbName, false)
+	err := db.Connect(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.Name, false)
 	if err != nil {
 		panic("Database error")
 	}
 	defer db.Close()
-	fmt.Println("Database connected")
+	log.Info("database connected")
 
 	pid := os.Getpid()
-	service, err := service.LoadModule(code, host, port, pid, false)
+	service, err := service.LoadModule(cfg.Module.Code, cfg.Module.Host, cfg.Module.Port, pid, false)
 	if err != nil {
-		fmt.Println(err.Error())
+		log.Errorf("loading module: %s", err.Error())
 		return
 	}
 
@@ -77,144 +58,461 @@ func registerModule(code, host string, port int, installModule InstallModule) {
 		moduleID = service.InstanceCode
 	}
 
-	fmt.Println("Module installing...")
+	log.Info("module installing")
 
 	if err := installModule(moduleID); err != nil {
-		fmt.Printf("\nModule installing error: %s\n", err.Error())
+		log.Errorf("module installing: %s", err.Error())
 	}
 
 }
 
-// ListenAndServe default module api listen and server
-func ListenAndServe(code, host string, port int, installModule InstallModule, moduleRouter *chi.Mux) {
-	stopChan := make(chan os.Signal)
-	signal.Notify(stopChan, os.Interrupt)
-
-	flag.Parse()
-	if *mdlPort != -1 {
-		port = *mdlPort
+// ListenAndServe default module api listen and server, cfg should be loaded with Config.Load
+// hooks are appended to the module lifecycle after the default ones: secrets, tracing, db, module, redis, socket, http and register
+func ListenAndServe(cfg *Config, installModule InstallModule, moduleRouter *chi.Mux, hooks ...Hook) {
+	if err := logger.SetLevel(cfg.LogLevel); err != nil {
+		logger.Log.Errorf("invalid log level: %s", err.Error())
+		return
 	}
-	if *mdlHost != "" {
-		host = *mdlHost
+	log := logger.Log.WithField("module", cfg.Module.Code)
+
+	server, err := NewServer(ServerOptions{Config: cfg, Router: moduleRouter, Hooks: hooks})
+	if err != nil {
+		log.Error(err.Error())
+		return
 	}
 
-	if *install {
-		registerModule(code, host, port, installModule)
+	if cfg.Install {
+		registerModule(cfg, installModule)
 		return
 	}
 
-	fmt.Printf("Starting Module %s...\n", code)
-	err := db.Connect(*dbHost, *dbPort, *dbUser, *dbPassword, *dbName, false)
-	if err != nil {
-		panic("Database error")
+	log.Info("starting module")
+	if err := server.Run(context.Background()); err != nil {
+		if errs, ok := err.(LifecycleError); ok {
+			errs.Log()
+		} else {
+			log.Error(err.Error())
+		}
+		os.Exit(1)
 	}
-	defer db.Close()
-	fmt.Println("Database connected")
+	log.Info("service stopped")
+}
 
-	pid := os.Getpid()
-	module, err := service.LoadModule(code, host, port, pid, *store)
-	if err != nil {
-		fmt.Printf("Loading module error: %s\n", err.Error())
-		return
+// ServerOptions defines the server config and dependencies,
+// dependencies not defined use the db, rdb and socket packages connections
+type ServerOptions struct {
+	Config   *Config
+	Router   *chi.Mux
+	Hooks    []Hook
+	Secrets  SecretProvider
+	Database Database
+	Cache    Cache
+	Socket   Socket
+	// Standalone skips loading the module instance from the database and the
+	// registration in api:modules, used by tests and local development
+	Standalone bool
+}
+
+// Server runs the module api and the lifecycle of its dependencies
+type Server struct {
+	cfg        atomic.Value
+	reload     sync.Mutex
+	provider   SecretProvider
+	db         Database
+	cache      Cache
+	socket     Socket
+	realtime   *realtime.Client
+	standalone bool
+	router     *chi.Mux
+	health     *health
+	cert       *certificate
+	lifecycle  *Lifecycle
+
+	module          *service.Module
+	httpServer      *http.Server
+	listener        net.Listener
+	registry        *registry.Registry
+	shutdownTracing func(ctx context.Context) error
+	cancelRealtime  context.CancelFunc
+	cancelRegistry  context.CancelFunc
+	cancelCertWatch context.CancelFunc
+}
+
+// NewServer resolves the secrets and creates the router, the dependencies are connected by Start
+func NewServer(opts ServerOptions) (*Server, error) {
+	if opts.Config == nil {
+		return nil, errors.New("server without config")
 	}
-	fmt.Printf("[Instance: %s | PID: %d]\n", module.InstanceCode, module.PID)
 
-	caCert, err := ioutil.ReadFile(*cert)
-	if err != nil {
-		panic("Invalid service certificate")
+	s := &Server{
+		provider:   opts.Secrets,
+		db:         opts.Database,
+		cache:      opts.Cache,
+		socket:     opts.Socket,
+		standalone: opts.Standalone,
+		cert:       &certificate{},
+		lifecycle:  NewLifecycle(),
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM(caCert)
+	s.cfg.Store(opts.Config)
 
-	tlsConfig := &tls.Config{
-		ClientCAs:  caCertPool,
-		ClientAuth: tls.RequireAndVerifyClientCert,
+	if s.provider == nil {
+		provider, err := NewSecretProvider(opts.Config.Secrets)
+		if err != nil {
+			return nil, fmt.Errorf("secrets provider: %s", err.Error())
+		}
+		s.provider = provider
+	}
+	if err := opts.Config.ResolveSecrets(s.provider); err != nil {
+		return nil, fmt.Errorf("resolving secrets: %s", err.Error())
 	}
-	tlsConfig.BuildNameToCertificate()
 
-	params, err := util.GetSystemParams()
-	if err != nil {
-		fmt.Printf("Database system param error - %s", err.Error())
-		return
+	if s.db == nil {
+		s.db = &sqlDatabase{moduleCode: opts.Config.Module.Code}
 	}
-	translation.SystemDefaultLanguageCode = params[constants.SysParamDefaultLanguageCode]
+	if s.cache == nil {
+		s.cache = newRedisCache(opts.Config.Module.Code)
+	}
+	s.realtime = realtime.Default
+	if s.socket == nil {
+		s.socket = &serviceSocket{}
+	} else if notifier, ok := s.socket.(SocketNotifier); ok {
+		s.realtime = realtime.NewClient(nil, s.socket.Emit)
+		notifier.OnConnectionChange(s.realtime.SetConnected)
+	} else {
+		s.realtime = realtime.NewClient(s.socket.Available, s.socket.Emit)
+	}
+
+	s.health = newHealth(map[string]HealthCheck{
+		"db":  s.db.Check,
+		"rdb": s.cache.Check,
+		"socket": func(ctx context.Context) error {
+			if !s.realtime.Available() {
+				return errors.New("realtime socket not connected")
+			}
+			return nil
+		},
+	})
+	s.router = s.newRouter(opts.Router)
+
+	s.lifecycle.Append(s.hooks()...)
+	s.lifecycle.Append(opts.Hooks...)
+	return s, nil
+}
+
+// Handler returns the server router, it can be used with httptest without starting the server
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// Realtime returns the client over the server socket, it is realtime.Default unless the socket is injected
+func (s *Server) Realtime() *realtime.Client {
+	return s.realtime
+}
+
+// Addr returns the listener address after the server is started
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
 
-	rdb.Init(*redisHost, *redisPort, *redisPass)
-	defer rdb.Close()
+// Start connects the dependencies and starts listening
+func (s *Server) Start(ctx context.Context) error {
+	return s.lifecycle.Start(ctx)
+}
+
+// Stop stops listening and closes the dependencies
+func (s *Server) Stop(ctx context.Context) error {
+	return s.lifecycle.Stop(ctx)
+}
 
-	socket.Init(module, *wsHost, *wsPort)
-	defer socket.Close()
+// Run starts the server and blocks until it receives a stop signal or the context is done
+func (s *Server) Run(ctx context.Context) error {
+	return s.lifecycle.Run(ctx)
+}
 
+// newRouter creates the server router with the module router mounted at /api/v1
+func (s *Server) newRouter(moduleRouter *chi.Mux) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(
 		middleware.Heartbeat("/ping"),
-		middleware.Logger,
+		metrics.Middleware,
+		logger.Middleware,
 		middleware.DefaultCompress,
 		middleware.RedirectSlashes,
 		middleware.Recoverer,
 	)
-	router.Mount("/api/v1", moduleRouter)
+	router.Get("/health/live", s.health.liveHandler)
+	router.Get("/health/ready", s.health.readyHandler)
+	router.Handle("/metrics", metrics.Handler())
+	if moduleRouter != nil {
+		router.With(tracing.Middleware).Mount("/api/v1", moduleRouter)
+	}
+	return router
+}
+
+// hooks defines the lifecycle hooks needed by every module
+func (s *Server) hooks() []Hook {
+	hooks := []Hook{
+		{Name: "secrets", OnReload: s.reloadSecrets},
+		{Name: "tracing", OnStart: s.startTracing, OnStop: s.stopTracing},
+		{Name: "db", OnStart: s.startDatabase, OnStop: s.stopDatabase},
+		{Name: "module", DependsOn: []string{"db"}, OnStart: s.startModule, OnStop: s.stopModule},
+		{Name: "redis", OnStart: s.startCache, OnStop: s.stopCache},
+		{Name: "socket", DependsOn: []string{"module"}, OnStart: s.startSocket, OnStop: s.stopSocket},
+		{Name: "http", DependsOn: []string{"tracing", "module", "redis", "socket"}, OnStart: s.startHTTP, OnStop: s.stopHTTP},
+	}
+	if !s.standalone {
+		hooks = append(hooks, Hook{Name: "register", DependsOn: []string{"http"}, Timeout: 15 * time.Second, OnStart: s.startRegistry, OnStop: s.stopRegistry})
+	}
+	return hooks
+}
+
+func (s *Server) startTracing(ctx context.Context) error {
+	var err error
+	cfg := s.config()
+	s.shutdownTracing, err = tracing.Init(ctx, cfg.Module.Code, cfg.Tracing)
+	return err
+}
+
+func (s *Server) stopTracing(ctx context.Context) error {
+	return s.shutdownTracing(ctx)
+}
+
+func (s *Server) startDatabase(ctx context.Context) error {
+	if err := s.db.Connect(s.config().Database); err != nil {
+		return err
+	}
+	stats, ok := s.db.(DatabaseStats)
+	if !ok {
+		return nil
+	}
+	if err := metrics.RegisterDBStats(stats.Stats); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) stopDatabase(ctx context.Context) error {
+	s.db.Close()
+	return nil
+}
+
+// startModule loads the module instance, standalone servers use an instance from the config
+func (s *Server) startModule(ctx context.Context) error {
+	cfg := s.config()
+	if s.standalone {
+		s.module = &service.Module{
+			Name:         cfg.Module.Code,
+			InstanceCode: fmt.Sprintf("%s-%d", cfg.Module.Code, os.Getpid()),
+			Port:         cfg.Module.Port,
+			PID:          os.Getpid(),
+		}
+		return nil
+	}
+
+	var err error
+	s.module, err = service.LoadModule(cfg.Module.Code, cfg.Module.Host, cfg.Module.Port, os.Getpid(), cfg.Store)
+	if err != nil {
+		return err
+	}
+	logger.Log.WithFields(logrus.Fields{"instance": s.module.InstanceCode, "pid": s.module.PID}).Info("module loaded")
+
+	params, err := util.GetSystemParams()
+	if err != nil {
+		return fmt.Errorf("database system param error - %s", err.Error())
+	}
+	translation.SystemDefaultLanguageCode = params[constants.SysParamDefaultLanguageCode]
+	return nil
+}
+
+func (s *Server) stopModule(ctx context.Context) error {
+	if !s.standalone {
+		s.module.RemoveModuleRegister()
+	}
+	return nil
+}
+
+func (s *Server) startCache(ctx context.Context) error {
+	return s.cache.Connect(s.config().Redis)
+}
+
+func (s *Server) stopCache(ctx context.Context) error {
+	s.cache.Close()
+	return nil
+}
+
+func (s *Server) startSocket(ctx context.Context) error {
+	if err := s.socket.Connect(s.module, s.config().Socket); err != nil {
+		return err
+	}
+
+	var realtimeCtx context.Context
+	realtimeCtx, s.cancelRealtime = context.WithCancel(context.Background())
+	go s.realtime.Run(realtimeCtx)
+	return nil
+}
+
+func (s *Server) stopSocket(ctx context.Context) error {
+	s.cancelRealtime()
+	s.socket.Close()
+	return nil
+}
+
+func (s *Server) startHTTP(ctx context.Context) error {
+	cfg := s.config()
+	if err := s.cert.load(cfg.TLS); err != nil {
+		return fmt.Errorf("invalid service certificate - %s", err.Error())
+	}
 
-	httpServer := &http.Server{
-		Addr:         module.URL(),
-		Handler:      router,
+	addr := s.module.URL()
+	if s.standalone {
+		addr = net.JoinHostPort(cfg.Module.Host, strconv.Itoa(cfg.Module.Port))
+	}
+	s.httpServer = &http.Server{
+		Addr:         addr,
+		Handler:      s.router,
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  60 * time.Second,
-		TLSConfig:    tlsConfig,
+		TLSConfig:    s.cert.tlsConfig(),
+	}
+
+	var err error
+	s.listener, err = net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return err
 	}
 
-	Validate = validator.New()
+	var watchCtx context.Context
+	watchCtx, s.cancelCertWatch = context.WithCancel(context.Background())
+	if cfg.TLS.Mode != TLSModePlaintext && cfg.TLS.ReloadInterval > 0 {
+		tlsCfg := cfg.TLS
+		go watchFiles(watchCtx, tlsCfg.ReloadInterval, certificateFiles(cfg), func() error {
+			return reloadCertificate(tlsCfg, s.provider, s.cert)
+		})
+	}
 
+	httpServer, listener := s.httpServer, s.listener
 	go func() {
-		fmt.Printf("Service %s listening on %d\n", module.Name, module.Port)
-		if err := httpServer.ListenAndServeTLS(*cert, *key); err != nil {
-			if strings.Contains(err.Error(), "bind: address already in use") {
-				if err := rdb.Delete("module:def:" + module.InstanceCode); err != nil {
-					fmt.Println(err)
-				}
-				if _, err := rdb.LRem("api:modules", 0, module.InstanceCode); err != nil {
-					fmt.Println(err)
-				}
-				fmt.Println("")
-				log.Fatalf("port %d already in use\n", port)
-			}
+		logger.Log.WithFields(logrus.Fields{"service": s.module.Name, "addr": listener.Addr().String(), "tls_mode": cfg.TLS.Mode}).Info("service listening")
+		serve := func() error { return httpServer.ServeTLS(listener, "", "") }
+		if httpServer.TLSConfig == nil {
+			serve = func() error { return httpServer.Serve(listener) }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
+			logger.Log.Errorf("service: %s", err.Error())
 		}
 	}()
+	return nil
+}
 
-	rdb.LPush("api:modules", module.InstanceCode)
-	rdb.Set("module:def:"+module.InstanceCode, module.JSON(), 0)
-
-	deadline := time.Now().Add(15 * time.Second)
-	for {
-		if socket.Available() || time.Now().After(deadline) {
-			if err := socket.Emit(socket.Message{
-				Recipients: []string{"service.api"},
-				Data:       "reload",
-			}); err != nil {
-				fmt.Println(err)
-			}
-			break
+func (s *Server) stopHTTP(ctx context.Context) error {
+	s.cancelCertWatch()
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *Server) startRegistry(ctx context.Context) error {
+	s.registry = registry.New(s.config().Module.Code, s.module, registry.DefaultTTL, s.realtime)
+	if err := s.registry.Register(); err != nil {
+		return err
+	}
+
+	if err := s.registry.EmitReload(ctx); err != nil {
+		// the failed start does not run stopRegistry, so the instance is removed here
+		if err := s.registry.Deregister(); err != nil {
+			logger.Log.Errorf("registry deregister: %s", err.Error())
+		}
+		return fmt.Errorf("registration broadcast not sent - %s", err.Error())
+	}
+
+	var registryCtx context.Context
+	registryCtx, s.cancelRegistry = context.WithCancel(context.Background())
+	go s.registry.Run(registryCtx)
+
+	// keeps the api:modules registration in line with the readiness checks
+	go s.health.watch(registryCtx, 10*time.Second, true, func(ready bool) error {
+		logger.Log.WithField("ready", ready).Info("service readiness changed")
+		change := s.registry.Deregister
+		if ready {
+			change = s.registry.Register
+		}
+		if err := change(); err != nil {
+			return err
+		}
+		emitCtx, cancel := context.WithTimeout(registryCtx, 15*time.Second)
+		defer cancel()
+		return s.registry.EmitReload(emitCtx)
+	})
+	return nil
+}
+
+func (s *Server) stopRegistry(ctx context.Context) error {
+	s.cancelRegistry()
+	if err := s.registry.Deregister(); err != nil {
+		return err
+	}
+	return s.registry.EmitReload(ctx)
+}
+
+// config returns the current config, it is replaced as a whole when the secrets are reloaded
+func (s *Server) config() *Config {
+	return s.cfg.Load().(*Config)
+}
+
+// reloadSecrets resolves the secrets again on a copy of the config, the services with changed
+// credentials are connected again before the copy replaces the current config
+func (s *Server) reloadSecrets(ctx context.Context) error {
+	s.reload.Lock()
+	defer s.reload.Unlock()
+
+	current := s.config()
+	reloaded := *current
+	if err := reloaded.ResolveSecrets(s.provider); err != nil {
+		return err
+	}
+
+	if err := s.cert.load(reloaded.TLS); err != nil {
+		return err
+	}
+
+	if reloaded.Redis.Password != current.Redis.Password {
+		if err := s.cache.Reconnect(reloaded.Redis); err != nil {
+			return err
 		}
 	}
 
-	<-stopChan
-	fmt.Println("\nShutting down Service...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	httpServer.Shutdown(ctx)
-	if err := rdb.Delete("module:def:" + module.InstanceCode); err != nil {
-		fmt.Println(err)
+	if reloaded.Database.Password != current.Database.Password {
+		if err := s.db.Reconnect(reloaded.Database); err != nil {
+			return err
+		}
+	}
+
+	s.cfg.Store(&reloaded)
+	return nil
+}
+
+// reloadCertificate reads the certificate, the key and the client CA bundle again
+func reloadCertificate(cfg TLSConfig, provider SecretProvider, cert *certificate) error {
+	keyPEM, err := cfg.resolveKey(provider)
+	if err != nil {
+		return err
 	}
-	if _, err := rdb.LRem("api:modules", 0, module.InstanceCode); err != nil {
-		fmt.Println(err)
+	cfg.KeyPEM = keyPEM
+	return cert.load(cfg)
+}
+
+// certificateFiles returns the files watched to reload the certificate
+func certificateFiles(cfg *Config) []string {
+	files := []string{cfg.TLS.Cert, cfg.TLS.Key}
+	if cfg.TLS.Mode == TLSModeMutual {
+		files = append(files, cfg.TLS.ClientCA)
 	}
-	module.RemoveModuleRegister()
-	if err := socket.Emit(socket.Message{
-		Recipients: []string{"service.api"},
-		Data:       "reload",
-	}); err != nil {
-		fmt.Println(err)
+	if cfg.Secrets.Provider == "file" {
+		files = append(files, filepath.Join(cfg.Secrets.Dir, SecretTLSKey))
 	}
-	defer cancel()
-	fmt.Println("Service stopped!")
+	return files
 }
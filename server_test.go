@@ -0,0 +1,353 @@
+package shared
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/realtime"
+	"github.com/agile-work/srv-mdl-shared/redis"
+	"github.com/agile-work/srv-shared/service"
+	"github.com/agile-work/srv-shared/socket"
+	"github.com/go-chi/chi"
+)
+
+type fakeDB struct {
+	mu         sync.Mutex
+	password   string
+	reconnects int
+	err        error
+}
+
+func (d *fakeDB) Connect(cfg DatabaseConfig) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.password = cfg.Password
+	return nil
+}
+
+func (d *fakeDB) Reconnect(cfg DatabaseConfig) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.password = cfg.Password
+	d.reconnects++
+	return nil
+}
+
+func (d *fakeDB) Close()                          {}
+func (d *fakeDB) Stats() sql.DBStats              { return sql.DBStats{} }
+func (d *fakeDB) Check(ctx context.Context) error { return nil }
+
+type fakeCache struct {
+	mu         sync.Mutex
+	reconnects int
+}
+
+func (c *fakeCache) Connect(RedisConfig) error { return nil }
+
+func (c *fakeCache) Reconnect(RedisConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reconnects++
+	return nil
+}
+
+func (c *fakeCache) Close()                          {}
+func (c *fakeCache) Check(ctx context.Context) error { return nil }
+
+type fakeSocket struct{}
+
+func (fakeSocket) Connect(*service.Module, SocketConfig) error { return nil }
+func (fakeSocket) Close()                                      {}
+func (fakeSocket) Available() bool                             { return true }
+func (fakeSocket) Emit(socket.Message) error                   { return nil }
+
+type mapSecrets struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func (m *mapSecrets) Secret(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.secrets[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return val, nil
+}
+
+func (m *mapSecrets) set(name, val string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.secrets[name] = val
+}
+
+func newTestServer(t *testing.T, secrets *mapSecrets, db *fakeDB, cache *fakeCache, router *chi.Mux) *Server {
+	cfg := NewConfig("test", "127.0.0.1", 0)
+	cfg.TLS.Mode = TLSModePlaintext
+	s, err := NewServer(ServerOptions{Config: cfg, Router: router, Secrets: secrets, Database: db, Cache: cache, Socket: fakeSocket{}, Standalone: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestServerStandalone(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/hello", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("hi")) })
+	s := newTestServer(t, &mapSecrets{secrets: map[string]string{}}, &fakeDB{}, &fakeCache{}, r)
+
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/api/v1/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	res, err = http.Get("http://" + s.Addr() + "/health/live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", res.StatusCode)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadSecrets(t *testing.T) {
+	tests := []struct {
+		name            string
+		secrets         map[string]string
+		reconnectErr    error
+		wantErr         bool
+		wantDB          string
+		wantDBReconnect int
+		wantRedis       int
+	}{
+		{name: "unchanged", secrets: map[string]string{}, wantDB: "old"},
+		{name: "database password", secrets: map[string]string{SecretDatabasePassword: "new"}, wantDB: "new", wantDBReconnect: 1},
+		{name: "redis password", secrets: map[string]string{SecretRedisPassword: "new"}, wantDB: "old", wantRedis: 1},
+		{name: "failed reconnect keeps the config", secrets: map[string]string{SecretDatabasePassword: "new"}, reconnectErr: errors.New("refused"), wantErr: true, wantDB: "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := &mapSecrets{secrets: map[string]string{SecretDatabasePassword: "old"}}
+			db, cache := &fakeDB{err: tt.reconnectErr}, &fakeCache{}
+			s := newTestServer(t, secrets, db, cache, nil)
+			previous := s.config()
+
+			for name, val := range tt.secrets {
+				secrets.set(name, val)
+			}
+			err := s.reloadSecrets(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reload error = %v", err)
+			}
+			if got := s.config().Database.Password; got != tt.wantDB {
+				t.Errorf("database password = %q, want %q", got, tt.wantDB)
+			}
+			if previous.Database.Password != "old" {
+				t.Errorf("previous config changed to %q", previous.Database.Password)
+			}
+			if db.reconnects != tt.wantDBReconnect || cache.reconnects != tt.wantRedis {
+				t.Errorf("reconnects db = %d redis = %d", db.reconnects, cache.reconnects)
+			}
+		})
+	}
+}
+
+// TestReloadSecretsConcurrent should be run with -race
+func TestReloadSecretsConcurrent(t *testing.T) {
+	secrets := &mapSecrets{secrets: map[string]string{}}
+	s := newTestServer(t, secrets, &fakeDB{}, &fakeCache{}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = s.config().Database.Password
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		secrets.set(SecretDatabasePassword, string(rune('a'+i)))
+		if err := s.reloadSecrets(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if got := s.config().Database.Password; got != string(rune('a'+19)) {
+		t.Errorf("database password = %q", got)
+	}
+}
+
+func TestServerRealtime(t *testing.T) {
+	tests := []struct {
+		name        string
+		socket      Socket
+		wantDefault bool
+	}{
+		{name: "socket package", wantDefault: true},
+		{name: "injected socket", socket: fakeSocket{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := realtime.Default
+			cfg := NewConfig("test", "127.0.0.1", 0)
+			cfg.TLS.Mode = TLSModePlaintext
+			s, err := NewServer(ServerOptions{Config: cfg, Secrets: &mapSecrets{secrets: map[string]string{}}, Database: &fakeDB{}, Cache: &fakeCache{}, Socket: tt.socket, Standalone: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if realtime.Default != previous {
+				t.Fatal("realtime.Default replaced")
+			}
+			if got := s.Realtime() == realtime.Default; got != tt.wantDefault {
+				t.Errorf("uses realtime.Default = %v", got)
+			}
+		})
+	}
+}
+
+type notifierSocket struct {
+	fakeSocket
+	callback func(connected bool)
+}
+
+func (n *notifierSocket) OnConnectionChange(callback func(connected bool)) {
+	n.callback = callback
+}
+
+func TestServerRealtimeNotifier(t *testing.T) {
+	sock := &notifierSocket{}
+	cfg := NewConfig("test", "127.0.0.1", 0)
+	cfg.TLS.Mode = TLSModePlaintext
+	s, err := NewServer(ServerOptions{Config: cfg, Secrets: &mapSecrets{secrets: map[string]string{}}, Database: &fakeDB{}, Cache: &fakeCache{}, Socket: sock, Standalone: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sock.callback == nil {
+		t.Fatal("connection callback not set")
+	}
+	for _, connected := range []bool{true, false} {
+		sock.callback(connected)
+		if got := s.Realtime().Available(); got != connected {
+			t.Errorf("available = %v, want %v", got, connected)
+		}
+	}
+}
+
+func TestServerHooksOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		standalone bool
+		want       string
+	}{
+		{name: "standalone", standalone: true, want: "secrets tracing db module redis socket http"},
+		{name: "registered", want: "secrets tracing db module redis socket http register"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{standalone: tt.standalone}
+			l := NewLifecycle()
+			l.Append(s.hooks()...)
+			hooks, err := l.order()
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, hook := range hooks {
+				names = append(names, hook.Name)
+			}
+			if got := strings.Join(names, " "); got != tt.want {
+				t.Errorf("order = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// commandRecorder answers every redis command with an integer reply and keeps the command names
+func commandRecorder(t *testing.T) func() []string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	commands := []string{}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				r := bufio.NewReader(nc)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if !strings.HasPrefix(line, "*") {
+						continue
+					}
+					r.ReadString('\n')
+					name, _ := r.ReadString('\n')
+					mu.Lock()
+					commands = append(commands, strings.TrimSpace(name))
+					mu.Unlock()
+					nc.Write([]byte(":1\r\n"))
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	redis.Init(addr.IP.String(), addr.Port, "")
+	t.Cleanup(func() {
+		redis.Close()
+		ln.Close()
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, commands...)
+	}
+}
+
+func TestStartRegistryBroadcastFailure(t *testing.T) {
+	commands := commandRecorder(t)
+	s := newTestServer(t, &mapSecrets{secrets: map[string]string{}}, &fakeDB{}, &fakeCache{}, chi.NewRouter())
+	s.module = &service.Module{Name: "test", InstanceCode: "test-1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.startRegistry(ctx); err == nil {
+		t.Fatal("startRegistry without the broadcast did not fail")
+	}
+	got := strings.Join(commands(), ",")
+	if want := "LREM,LPUSH,LREM"; got != want {
+		t.Errorf("commands = %s, want %s", got, want)
+	}
+}
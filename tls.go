@@ -0,0 +1,161 @@
+package shared
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/agile-work/srv-mdl-shared/logger"
+)
+
+// Listener modes defined by TLSConfig.Mode
+const (
+	TLSModeMutual    = "mtls"
+	TLSModeServer    = "tls"
+	TLSModePlaintext = "plaintext"
+)
+
+// certificate keeps the module certificate and the client CA pool so they can be replaced without restarting the listener
+type certificate struct {
+	mu        sync.RWMutex
+	mode      string
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// load parses the certificate, the key and the client CA bundle and replaces the current ones
+func (c *certificate) load(cfg TLSConfig) error {
+	if cfg.Mode == TLSModePlaintext {
+		return nil
+	}
+
+	certPEM, err := ioutil.ReadFile(cfg.Cert)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, cfg.KeyPEM)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if cfg.Mode == TLSModeMutual {
+		caPEM, err := ioutil.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certificates found in %s", cfg.ClientCA)
+		}
+	}
+
+	c.mu.Lock()
+	c.mode = cfg.Mode
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.mu.Unlock()
+	return nil
+}
+
+// GetCertificate returns the current certificate to the tls handshake
+func (c *certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// GetConfigForClient returns a copy of the listener tls config with the current client CA pool
+// to each handshake, the copy keeps the NextProtos so http/2 is still negotiated
+func (c *certificate) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cfg := c.base().Clone()
+	if c.mode == TLSModeMutual {
+		cfg.ClientCAs = c.clientCAs
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// tlsConfig returns the listener tls config, nil when the listener is plaintext
+func (c *certificate) tlsConfig() *tls.Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.mode == "" || c.mode == TLSModePlaintext {
+		return nil
+	}
+	cfg := c.base()
+	cfg.GetConfigForClient = c.GetConfigForClient
+	return cfg
+}
+
+// base returns the settings shared by the listener config and the config of each handshake
+func (c *certificate) base() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: c.GetCertificate,
+	}
+}
+
+// watchFiles checks the modification time of the files on each interval and calls onChange
+// when any of them changes, missing files are ignored until they are created
+func watchFiles(ctx context.Context, interval time.Duration, files []string, onChange func() error) {
+	modified := func() map[string]time.Time {
+		times := map[string]time.Time{}
+		for _, file := range files {
+			if info, err := os.Stat(file); err == nil {
+				times[file] = info.ModTime()
+			}
+		}
+		return times
+	}
+
+	last := modified()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := modified()
+			changed := len(current) != len(last)
+			for file, t := range current {
+				if !last[file].Equal(t) {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+			if err := onChange(); err != nil {
+				logger.Log.Errorf("certificate reload: %s", err.Error())
+				continue
+			}
+			logger.Log.Info("certificate reloaded")
+			last = current
+		}
+	}
+}
+
+// check validates the fields needed by the listener mode
+func (c TLSConfig) check() error {
+	if c.Mode == TLSModePlaintext {
+		return nil
+	}
+	if c.Cert == "" {
+		return errors.New("tls cert is required when the mode is " + c.Mode)
+	}
+	if c.Mode == TLSModeMutual && c.ClientCA == "" {
+		return errors.New("tls client_ca is required when the mode is " + c.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package shared
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate writes a self signed certificate valid for localhost and returns its files and key
+func testCertificate(t *testing.T, dir, name string) (string, []byte, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	path := filepath.Join(dir, name+".pem")
+	if err := ioutil.WriteFile(path, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, keyPEM, pair
+}
+
+func TestTLSConfigCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   TLSConfig
+		fails bool
+	}{
+		{"plaintext without files", TLSConfig{Mode: TLSModePlaintext}, false},
+		{"tls", TLSConfig{Mode: TLSModeServer, Cert: "cert.pem"}, false},
+		{"tls without cert", TLSConfig{Mode: TLSModeServer}, true},
+		{"tls without client ca", TLSConfig{Mode: TLSModeServer, Cert: "cert.pem"}, false},
+		{"mtls", TLSConfig{Mode: TLSModeMutual, Cert: "cert.pem", ClientCA: "ca.pem"}, false},
+		{"mtls without client ca", TLSConfig{Mode: TLSModeMutual, Cert: "cert.pem"}, true},
+		{"mtls without cert", TLSConfig{Mode: TLSModeMutual, ClientCA: "ca.pem"}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.check(); (err != nil) != tt.fails {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+}
+
+func TestTLSModes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, serverKey, _ := testCertificate(t, dir, "server")
+	clientCA, _, client := testCertificate(t, dir, "client")
+	_, _, stranger := testCertificate(t, dir, "stranger")
+	roots := x509.NewCertPool()
+	data, _ := ioutil.ReadFile(serverCert)
+	roots.AppendCertsFromPEM(data)
+
+	tests := []struct {
+		name        string
+		mode        string
+		certificate *tls.Certificate
+		accepted    bool
+	}{
+		{"tls without client certificate", TLSModeServer, nil, true},
+		{"mtls with client certificate", TLSModeMutual, &client, true},
+		{"mtls without client certificate", TLSModeMutual, nil, false},
+		{"mtls with unknown client certificate", TLSModeMutual, &stranger, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &certificate{}
+			if err := c.load(TLSConfig{Mode: tt.mode, Cert: serverCert, KeyPEM: serverKey, ClientCA: clientCA}); err != nil {
+				t.Fatal(err)
+			}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &http.Server{
+				Handler:   http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) { res.Write([]byte(req.Proto)) }),
+				TLSConfig: c.tlsConfig(),
+			}
+			go server.ServeTLS(listener, "", "")
+			defer server.Close()
+
+			clientConfig := &tls.Config{RootCAs: roots, NextProtos: []string{"h2", "http/1.1"}}
+			if tt.certificate != nil {
+				clientConfig.Certificates = []tls.Certificate{*tt.certificate}
+			}
+			conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+			if err == nil {
+				// tls 1.3 reports a rejected client certificate on the first read
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				_, err = conn.Read(make([]byte, 1))
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					err = nil
+				}
+				if err == nil && conn.ConnectionState().NegotiatedProtocol != "h2" {
+					t.Fatalf("negotiated %q, want h2", conn.ConnectionState().NegotiatedProtocol)
+				}
+				conn.Close()
+			}
+			if (err == nil) != tt.accepted {
+				t.Fatalf("got error %v, want accepted %t", err, tt.accepted)
+			}
+		})
+	}
+}
+
+func TestTLSPlaintext(t *testing.T) {
+	c := &certificate{}
+	if err := c.load(TLSConfig{Mode: TLSModePlaintext}); err != nil {
+		t.Fatal(err)
+	}
+	if c.tlsConfig() != nil {
+		t.Fatal("plaintext listener with tls config")
+	}
+}
+
+func TestTLSMissingClientCA(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	serverCert, serverKey, _ := testCertificate(t, dir, "server")
+
+	c := &certificate{}
+	if err := c.load(TLSConfig{Mode: TLSModeMutual, Cert: serverCert, KeyPEM: serverKey, ClientCA: filepath.Join(dir, "missing.pem")}); err == nil {
+		t.Fatal("loaded mtls without the client ca file")
+	}
+}
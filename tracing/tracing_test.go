@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestMiddlewareFlush(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "implicit ok", status: 0},
+		{name: "explicit status", status: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			router := chi.NewRouter()
+			router.Use(Middleware)
+			router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				f, ok := w.(http.Flusher)
+				if !ok {
+					t.Fatal("statusWriter is not a http.Flusher")
+				}
+				w.Write([]byte("row"))
+				f.Flush()
+				if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() != res {
+					t.Error("statusWriter does not unwrap to the response")
+				}
+			})
+			router.ServeHTTP(res, httptest.NewRequest("GET", "/", nil))
+
+			if !res.Flushed {
+				t.Error("response not flushed")
+			}
+		})
+	}
+}
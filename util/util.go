@@ -21,13 +21,21 @@ import (
 	"github.com/agile-work/srv-shared/sql-builder/db"
 )
 
-// LoadSQLOptionsFromURLQuery load sql options from url query
+// LoadSQLOptionsFromURLQuery load sql options from url query, negative values are ignored
+//
+// Deprecated: use response.Metadata with GenerateDBOptions, it paginates by page or by cursor
 func LoadSQLOptionsFromURLQuery(query url.Values, opt *db.Options) {
-	opt.Limit, _ = strconv.Atoi(query.Get("limit"))
-	opt.Offset, _ = strconv.Atoi(query.Get("offset"))
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		opt.Limit = limit
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		opt.Offset = offset
+	}
 }
 
 // GetColumnsFromBody get a body and return an string array with columns from the body
+//
+// Deprecated: use patch.Parse and Patch.Apply for partial updates
 func GetColumnsFromBody(body map[string]interface{}, object interface{}) ([]string, map[string]string) {
 	objectTranslationColumns := []string{}
 	if translation.FieldsRequestLanguageCode != "all" {
@@ -193,6 +201,8 @@ func ValidateContent(code string) error {
 }
 
 // GetBodyUpdatableJSONColumns get all columns from body based on the struct fields
+//
+// Deprecated: use patch.Parse and Patch.Apply for partial updates
 func GetBodyUpdatableJSONColumns(r *http.Request, isCreate bool, object interface{}, username, languageCode string) (map[string]interface{}, error) {
 	bodyMap, err := GetBodyMap(r)
 	if err != nil {
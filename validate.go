@@ -0,0 +1,56 @@
+package shared
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/agile-work/srv-mdl-shared/models/job"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// Validate global instance of the validator, fields are named by their json tags
+//   - translation_default: the translation has a value for the SystemDefaultLanguageCode
+//   - module_code: lower case letters, numbers and underscores starting with a letter
+//   - job_param_type: a type registered with job.RegisterParamTypes
+var Validate = newValidator()
+
+var moduleCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(jsonFieldName)
+	v.RegisterCustomTypeFunc(translationLanguages, translation.Translation{})
+	v.RegisterValidation("translation_default", validateTranslationDefault)
+	v.RegisterValidation("module_code", validateModuleCode)
+	v.RegisterValidation("job_param_type", validateJobParamType)
+	return v
+}
+
+// jsonFieldName returns the json name of the field, fields without json name keep the struct name
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// translationLanguages validates the translations by their languages
+func translationLanguages(field reflect.Value) interface{} {
+	return field.Interface().(translation.Translation).Language
+}
+
+func validateTranslationDefault(fl validator.FieldLevel) bool {
+	languages, ok := fl.Field().Interface().(map[string]string)
+	return ok && strings.TrimSpace(languages[translation.SystemDefaultLanguageCode]) != ""
+}
+
+func validateModuleCode(fl validator.FieldLevel) bool {
+	return moduleCodePattern.MatchString(fl.Field().String())
+}
+
+func validateJobParamType(fl validator.FieldLevel) bool {
+	return job.ValidParamType(fl.Field().String())
+}
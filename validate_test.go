@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"testing"
+
+	"github.com/agile-work/srv-mdl-shared/models/job"
+	"github.com/agile-work/srv-mdl-shared/models/translation"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type validateModule struct {
+	Code string                  `json:"code" validate:"required,module_code"`
+	Name translation.Translation `json:"name" validate:"required,translation_default"`
+}
+
+func validationTags(err error) map[string]string {
+	tags := map[string]string{}
+	if errs, ok := err.(validator.ValidationErrors); ok {
+		for _, fieldError := range errs {
+			tags[fieldError.Namespace()] = fieldError.Tag()
+		}
+	}
+	return tags
+}
+
+func TestValidators(t *testing.T) {
+	name := func(languages map[string]string) translation.Translation {
+		return translation.Translation{Language: languages}
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+		tag   string
+		want  map[string]string
+	}{
+		{
+			name:  "valid",
+			value: validateModule{Code: "core_1", Name: name(map[string]string{"pt-br": "Núcleo"})},
+			want:  map[string]string{},
+		},
+		{
+			name:  "invalid code and missing default language",
+			value: validateModule{Code: "Core-1", Name: name(map[string]string{"en": "Core"})},
+			want:  map[string]string{"validateModule.code": "module_code", "validateModule.name": "translation_default"},
+		},
+		{
+			name:  "missing translation",
+			value: validateModule{Code: "a"},
+			want:  map[string]string{"validateModule.name": "required"},
+		},
+		{
+			name:  "list items",
+			value: []validateModule{{Code: "a", Name: name(map[string]string{"pt-br": "A"})}, {Code: "b"}},
+			tag:   "dive",
+			want:  map[string]string{"[1].name": "required"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.tag != "" {
+				err = Validate.Var(tt.value, tt.tag)
+			} else {
+				err = Validate.Struct(tt.value)
+			}
+			if err != nil {
+				if _, ok := err.(validator.ValidationErrors); !ok {
+					t.Fatal(err)
+				}
+			}
+			got := validationTags(err)
+			if len(got) != len(tt.want) {
+				t.Fatalf("errors = %v, want %v", got, tt.want)
+			}
+			for namespace, tag := range tt.want {
+				if got[namespace] != tag {
+					t.Errorf("%s = %q, want %q", namespace, got[namespace], tag)
+				}
+			}
+		})
+	}
+}
+
+func TestJobParamType(t *testing.T) {
+	translated := translation.Translation{Language: map[string]string{"pt-br": "Job"}}
+	newJob := func(types ...string) job.Job {
+		j := job.Job{Code: "job", Name: translated, Description: translated}
+		for _, paramType := range types {
+			j.Params = append(j.Params, job.Param{Type: paramType})
+		}
+		return j
+	}
+
+	if err := Validate.Struct(newJob("blob")); err != nil {
+		t.Fatalf("types are not checked before the registration: %v", err)
+	}
+
+	job.RegisterParamTypes("string", "number")
+	tests := []struct {
+		name  string
+		types []string
+		want  map[string]string
+	}{
+		{name: "registered", types: []string{"string", "number"}, want: map[string]string{}},
+		{name: "not registered", types: []string{"string", "blob"}, want: map[string]string{"Job.parameters[1].type": "job_param_type"}},
+		{name: "missing", types: []string{""}, want: map[string]string{"Job.parameters[0].type": "required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validationTags(Validate.Struct(newJob(tt.types...)))
+			if len(got) != len(tt.want) {
+				t.Fatalf("errors = %v, want %v", got, tt.want)
+			}
+			for namespace, tag := range tt.want {
+				if got[namespace] != tag {
+					t.Errorf("%s = %q, want %q", namespace, got[namespace], tag)
+				}
+			}
+		})
+	}
+}